@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	internal "jaqen/internal"
+	mapper "jaqen/pkgs"
+
+	"github.com/spf13/cobra"
+)
+
+// readConfigFlag reads the config file given by the --config flag. The default
+// config file is optional, a missing one results in an empty config
+func readConfigFlag(cmd *cobra.Command) (internal.JaqenConfig, error) {
+	configPath, _ := cmd.Flags().GetString("config")
+	if configPath == "" {
+		configPath = internal.GetDefaultConfigPath()
+		if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+			return internal.JaqenConfig{}, nil
+		}
+	}
+
+	return internal.ReadConfig(configPath)
+}
+
+// addConfigFlag registers the --config flag read by readConfigFlag
+func addConfigFlag(cmd *cobra.Command) {
+	cmd.Flags().String("config", "", "config file to use, defaults to the user config file")
+}
+
+// configString returns a string setting of the config, overridden by the
+// flag of the same name when given
+func configString(cmd *cobra.Command, flag string, setting *string) string {
+	if value, _ := cmd.Flags().GetString(flag); value != "" {
+		return value
+	}
+	if setting != nil {
+		return *setting
+	}
+	return ""
+}
+
+// configGroups returns the ethnic groups of the config given by the --config
+// flag
+func configGroups(cmd *cobra.Command) (*mapper.EthnicGroups, error) {
+	config, err := readConfigFlag(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return internal.ConfigEthnicGroups(config)
+}
+
+// newResolver returns a resolver with the ethnic groups of the config, the
+// nation table of its FM version, its mapping overrides, its unknown
+// nationality policy and the rule table of its rules_path, or of rulesPath
+// when set
+func newResolver(config internal.JaqenConfig, rulesPath string) (*mapper.Resolver, error) {
+	groups, err := internal.ConfigEthnicGroups(config)
+	if err != nil {
+		return nil, err
+	}
+
+	fmVersion := ""
+	if config.FMVersion != nil {
+		fmVersion = *config.FMVersion
+	}
+
+	table, err := internal.LoadNationTable(fmVersion, groups)
+	if err != nil {
+		return nil, err
+	}
+	resolver := mapper.NewTableResolver(table)
+	resolver.SetEthnicGroups(groups)
+
+	if config.MappingOverride != nil {
+		if err := mapper.OverrideNationEthnicMapping(resolver, *config.MappingOverride); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.UnknownNation != nil {
+		unknownGroup := ""
+		if config.UnknownGroup != nil {
+			unknownGroup = *config.UnknownGroup
+		}
+		if err := resolver.SetUnknownNationPolicy(mapper.UnknownNationPolicy(*config.UnknownNation), mapper.Ethnic(unknownGroup)); err != nil {
+			return nil, err
+		}
+	}
+
+	if rulesPath == "" && config.RulesPath != nil {
+		rulesPath = *config.RulesPath
+	}
+	if rulesPath != "" {
+		rules, err := mapper.LoadEthnicRules(rulesPath, groups)
+		if err != nil {
+			return nil, err
+		}
+		resolver.SetRules(rules)
+	}
+
+	return resolver, nil
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	internal "jaqen/internal"
+	mapper "jaqen/pkgs"
+
+	"github.com/spf13/cobra"
+)
+
+// explainSetup reads the player files, mapping and image pool of the config
+// that an explanation needs. The mapping and pool are nil when not configured
+func explainSetup(cmd *cobra.Command, config internal.JaqenConfig, ethnicGroups *mapper.EthnicGroups) ([]string, *mapper.Mapping, *mapper.ImagePool, error) {
+	rtfPath := configString(cmd, "rtf", config.RTFPath)
+	if rtfPath == "" {
+		return nil, nil, nil, errors.New("no player file given, set rtf_path or --rtf")
+	}
+
+	rtfFiles, err := mapper.ExpandPlayerFiles(mapper.SplitPlayerFiles(rtfPath))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var mapping *mapper.Mapping
+	if xmlPath := configString(cmd, "xml", config.XMLPath); xmlPath != "" {
+		if _, err := os.Stat(xmlPath); err == nil {
+			mapping, err = mapper.NewMapping(xmlPath, configString(cmd, "fm-version", config.FMVersion))
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	var imagePool *mapper.ImagePool
+	if imgPath := configString(cmd, "img", config.IMGPath); imgPath != "" {
+		options := internal.ConfigPoolOptions(config, imgPath)
+		options.Groups = ethnicGroups
+		imagePool, err = mapper.NewImagePoolWithOptions(imgPath, options)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if config.ExcludeDupes != nil && *config.ExcludeDupes {
+			groups, _, err := imagePool.FindDuplicates(internal.ConfigDuplicateThreshold(config))
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			imagePool.ExcludeDuplicates(groups)
+		}
+
+		if config.EthnicFallbacks != nil {
+			if err := imagePool.SetFallbacks(*config.EthnicFallbacks); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		if config.TagRules != nil {
+			if err := imagePool.SetTagRules(*config.TagRules); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	return rtfFiles, mapping, imagePool, nil
+}
+
+func explainPlayer(cmd *cobra.Command, args []string) {
+	config, err := readConfigFlag(cmd)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if fmVersion, _ := cmd.Flags().GetString("fm-version"); fmVersion != "" {
+		config.FMVersion = &fmVersion
+	}
+
+	rulesPath, _ := cmd.Flags().GetString("rules")
+	resolver, err := newResolver(config, rulesPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	rtfFiles, mapping, imagePool, err := explainSetup(cmd, config, resolver.Groups())
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// preserve is on unless the config turns it off, as in the GUI
+	preserve := config.Preserve == nil || *config.Preserve
+
+	// the pool is drawn from as a run with the duplicate settings would
+	allowDuplicate := internal.DefaultAllowDuplicate
+	if config.AllowDuplicate != nil {
+		allowDuplicate = *config.AllowDuplicate
+	}
+	var strategy mapper.SelectionStrategy
+	if config.ImageStrategy != nil {
+		if strategy, err = mapper.ParseSelectionStrategy(*config.ImageStrategy); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	maxUses := 0
+	if config.MaxUses != nil {
+		maxUses = *config.MaxUses
+	}
+
+	var pins map[mapper.PlayerID]mapper.PlayerPin
+	if config.PlayerOverrides != nil {
+		pins, err = mapper.NewPlayerPins(*config.PlayerOverrides, resolver.Groups())
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	explanation, err := mapper.ExplainPlayer(resolver, rtfFiles, configString(cmd, "encoding", config.RTFEncoding), mapper.PlayerID(args[0]), mapping, imagePool, mapper.AssignOptions{
+		Preserve:       preserve,
+		AllowDuplicate: allowDuplicate,
+		Strategy:       strategy,
+		MaxUses:        maxUses,
+		ImagePrefix:    mapper.RelativeImagePrefix(configString(cmd, "xml", config.XMLPath), configString(cmd, "img", config.IMGPath)),
+		Roots:          imagePool.Roots(),
+		Groups:         resolver.Groups(),
+		Pins:           pins,
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout(), explanation)
+}
+
+var explainCmd = &cobra.Command{
+	Use:     "explain UID",
+	Short:   "Explains why a player gets an ethnicity and an image",
+	Long:    "Traces a player through the nation lookups, mapping overrides, ethnic rules and image pools, using the settings of the config",
+	Example: "  jaqen explain 2000133469 --config jaqen.toml",
+	Args:    cobra.ExactArgs(1),
+	Run:     explainPlayer,
+}
+
+func init() {
+	addConfigFlag(explainCmd)
+	explainCmd.Flags().String("rtf", "", "player files, defaults to the config's rtf_path")
+	explainCmd.Flags().String("encoding", "", "player file encoding, defaults to the config's rtf_encoding")
+	explainCmd.Flags().String("xml", "", "mapping file, defaults to the config's xml_path")
+	explainCmd.Flags().String("img", "", "image folder, defaults to the config's img_path")
+	explainCmd.Flags().String("fm-version", "", "Football Manager version, defaults to the config's fm_version")
+	explainCmd.Flags().String("rules", "", "rule table file, defaults to the config's rules_path")
+
+	rootCmd.AddCommand(explainCmd)
+}
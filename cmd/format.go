@@ -33,7 +33,7 @@ func formatConfig(cmd *cobra.Command, args []string) {
 		}
 		sort.Strings(nations)
 
-		mappingOverride := make(map[string]string)
+		mappingOverride := make(map[string]any)
 		for _, nation := range nations {
 			mappingOverride[nation] = (*config.MappingOverride)[nation]
 		}
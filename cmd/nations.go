@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	internal "jaqen/internal"
+	mapper "jaqen/pkgs"
+
+	"github.com/spf13/cobra"
+)
+
+func exportNations(cmd *cobra.Command, args []string) {
+	fmVersion, _ := cmd.Flags().GetString("fm-version")
+	format, _ := cmd.Flags().GetString("format")
+	builtin, _ := cmd.Flags().GetBool("builtin")
+
+	var table mapper.NationTable
+	var err error
+	if builtin {
+		table, err = mapper.BuiltinNationTable(fmVersion)
+	} else {
+		var groups *mapper.EthnicGroups
+		if groups, err = configGroups(cmd); err == nil {
+			table, err = internal.LoadNationTable(fmVersion, groups)
+		}
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	data, err := mapper.MarshalNationTable(table, format)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if _, err := cmd.OutOrStdout().Write(data); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func importNations(cmd *cobra.Command, args []string) {
+	fmVersion, _ := cmd.Flags().GetString("fm-version")
+
+	groups, err := configGroups(cmd)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	table, tablePath, err := internal.ImportNationTable(args[0], fmVersion, groups)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Imported %d nations and %d aliases for FM %s to %s\n", len(table.Nations), len(table.Aliases), table.Version, tablePath)
+}
+
+func resetNations(cmd *cobra.Command, args []string) {
+	if err := internal.RemoveNationTable(args[0]); err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "FM %s uses the built-in nation table\n", args[0])
+}
+
+func checkNations(cmd *cobra.Command, args []string) {
+	config, err := readConfigFlag(cmd)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if fmVersion, _ := cmd.Flags().GetString("fm-version"); fmVersion != "" {
+		config.FMVersion = &fmVersion
+	}
+
+	resolver, err := newResolver(config, "")
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	rtfPaths := args
+	if len(rtfPaths) == 0 {
+		if config.RTFPath == nil || *config.RTFPath == "" {
+			log.Fatalln("no player file given, set rtf_path or pass the files")
+		}
+		rtfPaths = mapper.SplitPlayerFiles(*config.RTFPath)
+	}
+
+	rtfFiles, err := mapper.ExpandPlayerFiles(rtfPaths)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	coverages, err := mapper.CheckNationCoverage(resolver, rtfFiles, configString(cmd, "encoding", config.RTFEncoding))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	out := cmd.OutOrStdout()
+	unmapped := 0
+	for _, coverage := range coverages {
+		switch {
+		case !coverage.Mapped():
+			unmapped++
+			fmt.Fprintf(out, "%-4s %6d  UNMAPPED\n", coverage.Nation, coverage.Players)
+		case coverage.Weights != nil:
+			fmt.Fprintf(out, "%-4s %6d  %s (%s)\n", coverage.Nation, coverage.Players, coverage.Ethnic, coverage.Weights)
+		default:
+			fmt.Fprintf(out, "%-4s %6d  %s\n", coverage.Nation, coverage.Players, coverage.Ethnic)
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d nations, %d unmapped\n", len(coverages), unmapped)
+	if snippet := mapper.MappingOverrideSnippet(coverages); snippet != "" {
+		fmt.Fprintf(out, "\nAdd to your config:\n\n%s", snippet)
+	}
+}
+
+var nationsCmd = &cobra.Command{
+	Use:   "nations",
+	Short: "Manages the nation tables",
+	Long:  "Manages the nation to ethnic tables used for each Football Manager version",
+}
+
+var nationsExportCmd = &cobra.Command{
+	Use:     "export",
+	Short:   "Prints a nation table",
+	Long:    "Prints the nation table used for an FM version, the imported one or else the built-in one of the version, a starting point for an updated table",
+	Example: "  jaqen nations export --fm-version 2024 > nations-2024.toml",
+	Args:    cobra.NoArgs,
+	Run:     exportNations,
+}
+
+var nationsImportCmd = &cobra.Command{
+	Use:     "import FILE",
+	Short:   "Imports a TOML or JSON nation table",
+	Long:    "Validates a TOML or JSON nation table and uses it instead of the built-in one for its FM version",
+	Example: "  jaqen nations import nations-2024.toml",
+	Args:    cobra.ExactArgs(1),
+	Run:     importNations,
+}
+
+var nationsResetCmd = &cobra.Command{
+	Use:   "reset VERSION",
+	Short: "Removes an imported nation table",
+	Long:  "Removes the imported nation table of an FM version so that the built-in one is used again",
+	Args:  cobra.ExactArgs(1),
+	Run:   resetNations,
+}
+
+var nationsCheckCmd = &cobra.Command{
+	Use:     "check [RTF...]",
+	Short:   "Reports the nations of a player export",
+	Long:    "Lists every nation of a player export with its player count and mapping, and suggests mapping overrides for the unmapped ones",
+	Example: "  jaqen nations check players.rtf",
+	Run:     checkNations,
+}
+
+func init() {
+	addConfigFlag(nationsExportCmd)
+	nationsExportCmd.Flags().String("fm-version", internal.DefaultFMVersion, "FM version of the table")
+	nationsExportCmd.Flags().String("format", "toml", "output format, toml or json")
+	nationsExportCmd.Flags().Bool("builtin", false, "print the built-in table even when one was imported")
+	addConfigFlag(nationsImportCmd)
+	nationsImportCmd.Flags().String("fm-version", "", "FM version to import the table for, defaults to the version of the file")
+
+	addConfigFlag(nationsCheckCmd)
+	nationsCheckCmd.Flags().String("fm-version", "", "FM version of the nation table, defaults to the config's fm_version")
+	nationsCheckCmd.Flags().String("encoding", "", "player file encoding, defaults to the config's rtf_encoding")
+
+	nationsCmd.AddCommand(nationsExportCmd, nationsImportCmd, nationsResetCmd, nationsCheckCmd)
+	rootCmd.AddCommand(nationsCmd)
+}
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	internal "jaqen/internal"
+	mapper "jaqen/pkgs"
+
+	"github.com/spf13/cobra"
+)
+
+// poolRoot returns the image root given as argument, or the config's img_path
+func poolRoot(args []string, config internal.JaqenConfig) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	if config.IMGPath == nil || *config.IMGPath == "" {
+		return "", errors.New("no image folder given, set img_path or pass the folder")
+	}
+	return *config.IMGPath, nil
+}
+
+// readPool reads the image folder given as argument, or the config's
+// img_path, with the ethnic groups and pool options of the config
+func readPool(cmd *cobra.Command, args []string) (internal.JaqenConfig, string, *mapper.ImagePool, error) {
+	config, err := readConfigFlag(cmd)
+	if err != nil {
+		return config, "", nil, err
+	}
+	groups, err := internal.ConfigEthnicGroups(config)
+	if err != nil {
+		return config, "", nil, err
+	}
+
+	imgPath, err := poolRoot(args, config)
+	if err != nil {
+		return config, "", nil, err
+	}
+
+	options := internal.ConfigPoolOptions(config, imgPath)
+	options.Groups = groups
+	imagePool, err := mapper.NewImagePoolWithOptions(imgPath, options)
+	return config, imgPath, imagePool, err
+}
+
+func initPool(cmd *cobra.Command, args []string) {
+	groups, err := configGroups(cmd)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	imgPath := args[0]
+	created, err := mapper.InitPool(imgPath, groups)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	out := cmd.OutOrStdout()
+	for _, folder := range created {
+		fmt.Fprintf(out, "created %s\n", folder)
+	}
+	fmt.Fprintf(out, "%d ethnic folders created in %s\n", len(created), imgPath)
+
+	manifestPath, _ := cmd.Flags().GetString("manifest")
+	if manifestPath == "" {
+		return
+	}
+	sourcePath, _ := cmd.Flags().GetString("from")
+	if sourcePath == "" {
+		sourcePath = imgPath
+	}
+
+	moved, issues, err := mapper.SortImages(sourcePath, imgPath, manifestPath, groups)
+	for _, issue := range issues {
+		fmt.Fprintf(out, "skipped %s\n", issue)
+	}
+	fmt.Fprintf(out, "Sorted %d images, %d skipped\n", moved, len(issues))
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func checkPool(cmd *cobra.Command, args []string) {
+	_, _, imagePool, err := readPool(cmd, args)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	report := imagePool.Report()
+
+	out := cmd.OutOrStdout()
+	if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
+		for _, info := range report.Images {
+			fmt.Fprintln(out, strings.TrimRight(fmt.Sprintf("%s %s %dx%d %s", info.File, info.Format, info.Width, info.Height, info.Tags), " "))
+		}
+	}
+	for _, file := range report.Ignored {
+		fmt.Fprintf(out, "ignored %s: not an image\n", file)
+	}
+	for _, issue := range report.Invalid {
+		fmt.Fprintf(out, "invalid %s\n", issue)
+	}
+	for _, issue := range report.Collisions {
+		fmt.Fprintf(out, "collision %s\n", issue)
+	}
+	for _, ethnic := range report.Missing {
+		fmt.Fprintf(out, "missing %s: no folder, the group is empty\n", imagePool.Groups().Folder(ethnic))
+	}
+
+	fmt.Fprintln(out, report)
+	if !report.Valid() {
+		log.Fatalln("the image folder has invalid or colliding images")
+	}
+}
+
+func dedupePool(cmd *cobra.Command, args []string) {
+	config, imgPath, imagePool, err := readPool(cmd, args)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	threshold := internal.ConfigDuplicateThreshold(config)
+	if cmd.Flags().Changed("threshold") {
+		threshold, _ = cmd.Flags().GetInt("threshold")
+	}
+
+	groups, issues, err := imagePool.FindDuplicates(threshold)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	out := cmd.OutOrStdout()
+	for _, issue := range issues {
+		fmt.Fprintf(out, "invalid %s\n", issue)
+	}
+
+	duplicates := 0
+	for _, group := range groups {
+		fmt.Fprintln(out, group.Images[0].File)
+		for i, duplicate := range group.Duplicates() {
+			fmt.Fprintf(out, "  = %s (distance %d)\n", duplicate.File, group.Distances[i+1])
+			duplicates++
+		}
+	}
+	fmt.Fprintf(out, "%d groups, %d duplicates at threshold %d\n", len(groups), duplicates, threshold)
+
+	if quarantinePath, _ := cmd.Flags().GetString("quarantine"); quarantinePath != "" {
+		moved, err := mapper.QuarantineDuplicates(imgPath, imagePool.Roots(), quarantinePath, groups)
+		fmt.Fprintf(out, "Moved %d duplicates to %s\n", moved, quarantinePath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
+
+func reportUsage(cmd *cobra.Command, args []string) {
+	config, err := readConfigFlag(cmd)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	groups, err := internal.ConfigEthnicGroups(config)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	xmlPath := configString(cmd, "xml", config.XMLPath)
+	if xmlPath == "" {
+		log.Fatalln("no mapping file given, set xml_path or --xml")
+	}
+	mapping, err := mapper.NewMapping(xmlPath, configString(cmd, "fm-version", config.FMVersion))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// with an image folder, unused images are listed and paths are grouped
+	// relative to it
+	var imagePool *mapper.ImagePool
+	options := mapper.AssignOptions{Groups: groups}
+	if imgPath := configString(cmd, "img", config.IMGPath); imgPath != "" {
+		poolOptions := internal.ConfigPoolOptions(config, imgPath)
+		poolOptions.Groups = groups
+		imagePool, err = mapper.NewImagePoolWithOptions(imgPath, poolOptions)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		options.ImagePrefix = mapper.RelativeImagePrefix(xmlPath, imgPath)
+		options.Roots = imagePool.Roots()
+	}
+
+	out := cmd.OutOrStdout()
+	for _, usage := range mapper.UsageReport(mapping, imagePool, options) {
+		ethnic := string(usage.Ethnic)
+		if ethnic == "" {
+			ethnic = "Outside of the ethnic folders"
+		}
+		fmt.Fprintf(out, "%s: %d players, %d images\n", ethnic, usage.Uses(), len(usage.Images))
+
+		for _, image := range usage.Images {
+			players := make([]string, len(image.Players))
+			for i, id := range image.Players {
+				players[i] = string(id)
+			}
+			fmt.Fprintln(out, strings.TrimRight(fmt.Sprintf("  %4d  %s  %s", len(image.Players), image.Image, strings.Join(players, ", ")), " "))
+		}
+	}
+}
+
+var poolCmd = &cobra.Command{
+	Use:   "pool",
+	Short: "Sets up and inspects the image pool",
+	Long:  "Sets up and inspects the image folder faces are picked from",
+}
+
+var poolInitCmd = &cobra.Command{
+	Use:     "init DIR",
+	Short:   "Scaffolds a new face pack",
+	Long:    "Creates the image folder with a folder for every ethnic group, custom groups of the config included, and a default config.xml. With a manifest, the images of a flat folder are moved into their ethnic folders, one \"file,ethnic\" CSV row per image",
+	Example: "  jaqen pool init ~/FM/graphics/faces --manifest faces.csv --from ~/Downloads/faces",
+	Args:    cobra.ExactArgs(1),
+	Run:     initPool,
+}
+
+var poolCheckCmd = &cobra.Command{
+	Use:     "check [DIR]",
+	Short:   "Validates the images of the image folder",
+	Long:    "Reads the image folder like a run does and reports files that are not images, images that cannot be decoded, images that collide once their extension is dropped and missing ethnic folders",
+	Example: "  jaqen pool check ~/FM/graphics/faces --verbose",
+	Args:    cobra.MaximumNArgs(1),
+	Run:     checkPool,
+}
+
+var poolDedupeCmd = &cobra.Command{
+	Use:     "dedupe [DIR]",
+	Short:   "Finds near-duplicate images",
+	Long:    "Compares a perceptual hash of every image of the image folder and lists the groups showing the same photo. The first image of a group, in file order, is kept",
+	Example: "  jaqen pool dedupe ~/FM/graphics/faces --threshold 6 --quarantine ~/faces-duplicates",
+	Args:    cobra.MaximumNArgs(1),
+	Run:     dedupePool,
+}
+
+var poolUsageCmd = &cobra.Command{
+	Use:     "usage",
+	Short:   "Reports how often each image is used",
+	Long:    "Lists the images of the mapping by ethnic group with the number of players and the player UIDs using them. Unused images are listed too when an image folder is set",
+	Example: "  jaqen pool usage --xml config.xml --img ~/FM/graphics/faces",
+	Args:    cobra.NoArgs,
+	Run:     reportUsage,
+}
+
+func init() {
+	addConfigFlag(poolInitCmd)
+	poolInitCmd.Flags().String("manifest", "", "CSV file of \"file,ethnic\" rows sorting images into the ethnic folders")
+	poolInitCmd.Flags().String("from", "", "folder holding the images of the manifest, defaults to DIR")
+
+	addConfigFlag(poolCheckCmd)
+	poolCheckCmd.Flags().Bool("verbose", false, "list every image with its format, dimensions and tags")
+
+	addConfigFlag(poolDedupeCmd)
+	poolDedupeCmd.Flags().Int("threshold", mapper.DefaultDuplicateThreshold, "largest hash distance between duplicates, from 0 to 64, defaults to the config's duplicate_threshold")
+	poolDedupeCmd.Flags().String("quarantine", "", "folder to move the duplicates to, outside of the image folder and its additional roots")
+
+	addConfigFlag(poolUsageCmd)
+	poolUsageCmd.Flags().String("xml", "", "mapping file, defaults to the config's xml_path")
+	poolUsageCmd.Flags().String("img", "", "image folder, defaults to the config's img_path")
+	poolUsageCmd.Flags().String("fm-version", "", "FM version of the mapping, defaults to the config's fm_version")
+
+	poolCmd.AddCommand(poolInitCmd, poolCheckCmd, poolDedupeCmd, poolUsageCmd)
+	rootCmd.AddCommand(poolCmd)
+}
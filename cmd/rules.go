@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	mapper "jaqen/pkgs"
+
+	"github.com/spf13/cobra"
+)
+
+// loadRules returns a resolver with the ethnic groups and mapping overrides of
+// the config and the rule table selected by --rules, the config's rules_path
+// or the default table
+func loadRules(cmd *cobra.Command) (*mapper.Resolver, error) {
+	config, err := readConfigFlag(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	rulesPath, _ := cmd.Flags().GetString("rules")
+	return newResolver(config, rulesPath)
+}
+
+// parseRuleSample reads a sample such as "GER/RSA:3" or "ESP:1"
+func parseRuleSample(sample string) (string, string, int, error) {
+	nations, value, found := strings.Cut(sample, ":")
+	if !found {
+		return "", "", 0, fmt.Errorf("sample %q is not in the form NAT[/NAT2]:VALUE", sample)
+	}
+
+	ethnicValue, err := strconv.Atoi(value)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("sample %q has an invalid ethnic value", sample)
+	}
+
+	nationality1, nationality2, _ := strings.Cut(nations, "/")
+	return strings.ToUpper(nationality1), strings.ToUpper(nationality2), ethnicValue, nil
+}
+
+func testRules(cmd *cobra.Command, args []string) {
+	resolver, err := loadRules(cmd)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	rules := resolver.Rules()
+
+	describeNation := func(nation string) string {
+		if nation == "" {
+			return "-"
+		}
+		if weights, ok := resolver.Weights(nation); ok {
+			return fmt.Sprintf("%s (%s)", nation, weights)
+		}
+		ethnic, ok := resolver.Nation(nation)
+		if !ok {
+			return fmt.Sprintf("%s (unknown)", nation)
+		}
+		return fmt.Sprintf("%s (%s)", nation, ethnic)
+	}
+
+	out := cmd.OutOrStdout()
+	for _, sample := range args {
+		nationality1, nationality2, ethnicValue, err := parseRuleSample(sample)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		fmt.Fprintf(out, "%s / %s, ethnic value %d: ", describeNation(nationality1), describeNation(nationality2), ethnicValue)
+
+		// traced as a run resolves the player, unknown nation policy included
+		_, trace, err := resolver.Trace(nationality1, nationality2, ethnicValue)
+		switch {
+		case err != nil:
+			fmt.Fprintf(out, "error: %v\n", err)
+			continue
+		case trace.RuleIndex < 0:
+			fmt.Fprintf(out, "%s by the %s mapping override\n", trace.Weights, trace.OverrideKey)
+			continue
+		}
+
+		fmt.Fprintf(out, "%s by rule %d %s\n", trace.RuleResult, trace.RuleIndex+1, rules[trace.RuleIndex])
+		if trace.Warning != "" {
+			fmt.Fprintf(out, "  warning: %s\n", trace.Warning)
+		}
+		// only groups the rule took from a weighted nation are drawn
+		if trace.OverrideKey != "" {
+			fmt.Fprintf(out, "  drawn from the %s weights: %s\n", trace.OverrideKey, trace.Weights)
+		}
+	}
+}
+
+func exportRules(cmd *cobra.Command, args []string) {
+	resolver, err := loadRules(cmd)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	data, err := mapper.MarshalEthnicRules(resolver.Rules())
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if _, err := cmd.OutOrStdout().Write(data); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+var rulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "Inspects the ethnic rule table",
+	Long:  "Inspects the rule table that combines FM ethnic values with nationalities",
+}
+
+var rulesTestCmd = &cobra.Command{
+	Use:     "test NAT[/NAT2]:VALUE...",
+	Short:   "Evaluates sample nation/value combinations",
+	Long:    "Evaluates sample nation/value combinations against the rule table and prints the rule that fired",
+	Example: "  jaqen rules test GER/RSA:3 ESP:1 BRA/ITA:7",
+	Args:    cobra.MinimumNArgs(1),
+	Run:     testRules,
+}
+
+var rulesExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Prints the rule table as TOML",
+	Long:  "Prints the rule table in use as TOML, a starting point for a custom rules_path file",
+	Args:  cobra.NoArgs,
+	Run:   exportRules,
+}
+
+func init() {
+	for _, command := range []*cobra.Command{rulesTestCmd, rulesExportCmd} {
+		addConfigFlag(command)
+		command.Flags().String("rules", "", "rule table file, defaults to the config's rules_path")
+		rulesCmd.AddCommand(command)
+	}
+
+	rootCmd.AddCommand(rulesCmd)
+}
@@ -22,16 +22,24 @@ type JaqenGUI struct {
 	imgDirEntry     *widget.Entry
 	xmlPathEntry    *widget.Entry
 	rtfPathEntry    *widget.Entry
+	encodingSelect  *widget.Select
 	fmVersionSelect *widget.Select
 	logLabel        *widget.Label
 	progressBar     *widget.ProgressBar
 	runButton       *widget.Button
 
 	// Settings
-	preserveCheck       *widget.Check
-	allowDuplicateCheck *widget.Check
-	mappingOverrideList *widget.List
-	mappingOverrides    map[string]string
+	preserveCheck         *widget.Check
+	allowDuplicateCheck   *widget.Check
+	strategySelect        *widget.Select
+	maxUsesEntry          *widget.Entry
+	excludeDupesCheck     *widget.Check
+	rulesPathEntry        *widget.Entry
+	unknownPolicySelect   *widget.Select
+	unknownGroupSelect    *widget.Select
+	mappingOverrideList   *widget.List
+	availableEthnicsLabel *widget.Label
+	mappingOverrides      map[string]any // ethnic name or weights per nation
 
 	// Image preview
 	imagePreview1 *widget.Card
@@ -62,7 +70,7 @@ func New() *JaqenGUI {
 	return &JaqenGUI{
 		app:              myApp,
 		window:           window,
-		mappingOverrides: make(map[string]string),
+		mappingOverrides: make(map[string]any),
 	}
 }
 
@@ -0,0 +1,121 @@
+package gui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	mapper "jaqen/pkgs"
+)
+
+// showExplainDialog asks for a player UID and explains how the player gets
+// an ethnicity and an image
+func (g *JaqenGUI) showExplainDialog() {
+	if g.rtfPathEntry.Text == "" {
+		dialog.ShowError(fmt.Errorf("RTF file path is required"), g.window)
+		return
+	}
+
+	uidEntry := widget.NewEntry()
+	uidEntry.SetPlaceHolder("Player UID, ex: 2000133469")
+
+	formItems := []*widget.FormItem{
+		{Text: "Player UID", Widget: uidEntry},
+	}
+
+	dialog.ShowForm("Explain Player", "Explain", "Cancel", formItems, func(confirmed bool) {
+		uid := strings.TrimSpace(uidEntry.Text)
+		if !confirmed || uid == "" {
+			return
+		}
+
+		go g.explainPlayer(mapper.PlayerID(uid))
+	}, g.window)
+}
+
+// explainPlayer traces a player with the current settings and shows the result
+func (g *JaqenGUI) explainPlayer(id mapper.PlayerID) {
+	explanation, err := g.buildExplanation(id)
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(err, g.window)
+		})
+		return
+	}
+
+	if g.logger != nil {
+		g.logger.Printf("Explained player %s:\n%s", id, explanation)
+	}
+
+	fyne.Do(func() {
+		content := widget.NewLabel(explanation.String())
+		content.TextStyle = fyne.TextStyle{Monospace: true}
+
+		scroll := container.NewScroll(content)
+		scroll.SetMinSize(fyne.NewSize(700, 350))
+
+		explainDialog := dialog.NewCustom(fmt.Sprintf("Player %s", id), "Close", scroll, g.window)
+		explainDialog.Show()
+	})
+}
+
+// buildExplanation traces a player without modifying the mapping. The
+// mapping and the image pool are only used when their paths are set
+func (g *JaqenGUI) buildExplanation(id mapper.PlayerID) (mapper.Explanation, error) {
+	resolver, err := g.newResolver()
+	if err != nil {
+		return mapper.Explanation{}, err
+	}
+
+	rtfFiles, err := mapper.ExpandPlayerFiles(mapper.SplitPlayerFiles(g.rtfPathEntry.Text))
+	if err != nil {
+		return mapper.Explanation{}, fmt.Errorf("error finding player files: %w", err)
+	}
+
+	var mapping *mapper.Mapping
+	if _, err := os.Stat(g.xmlPathEntry.Text); g.xmlPathEntry.Text != "" && err == nil {
+		mapping, err = mapper.NewMapping(g.xmlPathEntry.Text, g.fmVersionSelect.Selected)
+		if err != nil {
+			return mapper.Explanation{}, fmt.Errorf("error creating mapping: %w", err)
+		}
+	}
+
+	var imagePool *mapper.ImagePool
+	if g.imgDirEntry.Text != "" {
+		imagePool, err = g.loadImagePool(resolver.Groups())
+		if err != nil {
+			return mapper.Explanation{}, err
+		}
+	}
+
+	pins, err := g.playerPins(resolver.Groups())
+	if err != nil {
+		return mapper.Explanation{}, err
+	}
+
+	// the pool is drawn from as a run with the current settings would
+	allowDuplicates := true
+	if g.allowDuplicateCheck != nil {
+		allowDuplicates = g.allowDuplicateCheck.Checked
+	}
+	maxUses, err := parseMaxUses(g.maxUsesEntry.Text)
+	if err != nil {
+		return mapper.Explanation{}, err
+	}
+
+	return mapper.ExplainPlayer(resolver, rtfFiles, g.encodingSelect.Selected, id, mapping, imagePool, mapper.AssignOptions{
+		Preserve:       g.preserveCheck != nil && g.preserveCheck.Checked,
+		AllowDuplicate: allowDuplicates,
+		Strategy:       mapper.SelectionStrategy(g.strategySelect.Selected),
+		MaxUses:        maxUses,
+		ImagePrefix:    mapper.RelativeImagePrefix(g.xmlPathEntry.Text, g.imgDirEntry.Text),
+		Roots:          imagePool.Roots(),
+		Groups:         resolver.Groups(),
+		Pins:           pins,
+	})
+}
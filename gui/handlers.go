@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"fyne.io/fyne/v2"
@@ -35,6 +34,7 @@ func (g *JaqenGUI) runProcessing() {
 		g.logger.Printf("Starting face mapping process")
 		g.logger.Printf("XML Path: %s", g.xmlPathEntry.Text)
 		g.logger.Printf("RTF Path: %s", g.rtfPathEntry.Text)
+		g.logger.Printf("RTF Encoding: %s", g.encodingSelect.Selected)
 		g.logger.Printf("Image Directory: %s", g.imgDirEntry.Text)
 		g.logger.Printf("FM Version: %s", g.fmVersionSelect.Selected)
 	}
@@ -99,16 +99,12 @@ func (g *JaqenGUI) processFiles() {
 		g.logger.Println("Creating mapping...")
 	}
 
-	// Apply mapping overrides
-	if len(g.mappingOverrides) > 0 {
-		err := mapper.OverrideNationEthnicMapping(g.mappingOverrides)
-		if err != nil {
-			fyne.Do(func() {
-				// Create a detailed error message
-				dialog.ShowError(fmt.Errorf("error applying mapping overrides:\n\n%v\n\nPlease check your mapping overrides in Settings and ensure all ethnic groups are valid", err), g.window)
-			})
-			return
-		}
+	resolver, err := g.newResolver()
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(err, g.window)
+		})
+		return
 	}
 
 	// Create mapping
@@ -129,10 +125,10 @@ func (g *JaqenGUI) processFiles() {
 	}
 
 	// Create image pool
-	imagePool, err := mapper.NewImagePool(g.imgDirEntry.Text)
+	imagePool, err := g.loadImagePool(resolver.Groups())
 	if err != nil {
 		fyne.Do(func() {
-			dialog.ShowError(fmt.Errorf("error loading image pool: %w", err), g.window)
+			dialog.ShowError(err, g.window)
 		})
 		return
 	}
@@ -145,8 +141,20 @@ func (g *JaqenGUI) processFiles() {
 		g.logger.Println("Processing players...")
 	}
 
-	// Get players
-	players, err := mapper.GetPlayers(g.rtfPathEntry.Text)
+	// Get players, merging every export listed in the RTF path
+	rtfFiles, err := mapper.ExpandPlayerFiles(mapper.SplitPlayerFiles(g.rtfPathEntry.Text))
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(fmt.Errorf("error finding player files: %w", err), g.window)
+		})
+		return
+	}
+
+	if g.logger != nil && len(rtfFiles) > 1 {
+		g.logger.Printf("Merging %d player files", len(rtfFiles))
+	}
+
+	players, conflicts, err := mapper.GetPlayersFromFiles(resolver, rtfFiles, g.encodingSelect.Selected)
 	if err != nil {
 		fyne.Do(func() {
 			// Check if this is an ethnicity-related error
@@ -162,6 +170,17 @@ func (g *JaqenGUI) processFiles() {
 		return
 	}
 
+	if g.logger != nil {
+		for _, conflict := range conflicts {
+			g.logger.Printf("Warning: conflicting rows for %s", conflict)
+		}
+		for _, player := range players {
+			if player.Warning != "" {
+				g.logger.Printf("Warning: player %s: %s", player.ID, player.Warning)
+			}
+		}
+	}
+
 	fyne.Do(func() {
 		g.progressBar.SetValue(0.5)
 	})
@@ -170,48 +189,62 @@ func (g *JaqenGUI) processFiles() {
 		g.logger.Println("Assigning faces to players...")
 	}
 
-	// Process each player
-	totalPlayers := len(players)
-	for i, player := range players {
-		if g.preserveCheck != nil && g.preserveCheck.Checked && mapping.Exist(player.ID) {
-			continue
-		}
+	allowDuplicates := true
+	if g.allowDuplicateCheck != nil {
+		allowDuplicates = g.allowDuplicateCheck.Checked
+	}
 
-		allowDuplicates := true
-		if g.allowDuplicateCheck != nil {
-			allowDuplicates = g.allowDuplicateCheck.Checked
-		}
-		imgFilename, err := imagePool.GetRandomImagePath(player.Ethnic, !allowDuplicates)
-		if err != nil {
-			log.Printf("Error getting image for player %s: %v", player.ID, err)
-			continue
-		}
+	maxUses, err := parseMaxUses(g.maxUsesEntry.Text)
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(err, g.window)
+		})
+		return
+	}
 
-		// Calculate relative path
-		rel := ""
-		imgDirPathAbs, _ := filepath.Abs(g.imgDirEntry.Text)
-		xmlFilePathAbs, _ := filepath.Abs(g.xmlPathEntry.Text)
+	pins, err := g.playerPins(resolver.Groups())
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(err, g.window)
+		})
+		return
+	}
 
-		if imgDirPathAbs != filepath.Dir(xmlFilePathAbs) {
-			rel, _ = filepath.Rel(xmlFilePathAbs, imgDirPathAbs)
-		}
-		rel = strings.TrimPrefix(rel, "./")
+	// Process each player
+	result := mapper.AssignImages(mapping, imagePool, players, mapper.AssignOptions{
+		Preserve:       g.preserveCheck != nil && g.preserveCheck.Checked,
+		AllowDuplicate: allowDuplicates,
+		Strategy:       mapper.SelectionStrategy(g.strategySelect.Selected),
+		MaxUses:        maxUses,
+		ImagePrefix:    mapper.RelativeImagePrefix(g.xmlPathEntry.Text, g.imgDirEntry.Text),
+		Roots:          imagePool.Roots(),
+		Groups:         resolver.Groups(),
+		Pins:           pins,
+		Progress: func(done int, total int) {
+			if total == 0 {
+				return
+			}
 
-		mapping.MapToImage(player.ID, mapper.FilePath(filepath.Join(rel, string(player.Ethnic), string(imgFilename))))
+			// Log every 10% or so to avoid spam
+			if done%10 == 0 || done == total {
+				if g.logger != nil {
+					g.logger.Printf("Processing player %d of %d...", done, total)
+				}
+			}
 
-		// Update progress
-		progress := 0.5 + (float64(i+1)/float64(totalPlayers))*0.4
+			progress := 0.5 + (float64(done)/float64(total))*0.4
+			fyne.Do(func() {
+				g.progressBar.SetValue(progress)
+			})
+		},
+	})
 
-		// Log every 10% or so to avoid spam
-		if i%10 == 0 || i == totalPlayers-1 {
-			if g.logger != nil {
-				g.logger.Printf("Processing player %d of %d...", i+1, totalPlayers)
-			}
-		}
+	for _, err := range result.Errors {
+		log.Printf("Error getting image for %v", err)
+	}
 
-		fyne.Do(func() {
-			g.progressBar.SetValue(progress)
-		})
+	if g.logger != nil {
+		g.logger.Println(result)
 	}
 
 	fyne.Do(func() {
@@ -243,6 +276,129 @@ func (g *JaqenGUI) processFiles() {
 
 	fyne.Do(func() {
 		g.progressBar.SetValue(1.0)
-		dialog.ShowInformation("Success", "Face mapping completed successfully!", g.window)
+		dialog.ShowInformation("Success", fmt.Sprintf("Face mapping completed successfully!\n\n%s", result), g.window)
 	})
 }
+
+// newResolver applies the ethnic groups and returns a resolver with the
+// nation table, mapping overrides and rule table of the current settings. Each run gets its
+// own resolver so that overrides of other profiles never leak into it
+func (g *JaqenGUI) newResolver() (*mapper.Resolver, error) {
+	// Read user-defined ethnic groups before anything refers to them
+	groups, err := g.ethnicGroups()
+	if err != nil {
+		return nil, fmt.Errorf("error applying ethnic groups:\n\n%v\n\nPlease check the ethnic_groups of your config", err)
+	}
+
+	// Start from the nation table of the FM version, imported or built in
+	table, err := internal.LoadNationTable(g.fmVersionSelect.Selected, groups)
+	if err != nil {
+		return nil, fmt.Errorf("error loading nation table:\n\n%v\n\nRun \"jaqen nations reset %s\" to use the built-in table", err, g.fmVersionSelect.Selected)
+	}
+	resolver := mapper.NewTableResolver(table)
+	resolver.SetEthnicGroups(groups)
+
+	// Apply mapping overrides
+	if len(g.mappingOverrides) > 0 {
+		err := mapper.OverrideNationEthnicMapping(resolver, g.mappingOverrides)
+		if err != nil {
+			// Create a detailed error message
+			return nil, fmt.Errorf("error applying mapping overrides:\n\n%v\n\nPlease check your mapping overrides in Settings and ensure all ethnic groups are valid", err)
+		}
+	}
+
+	// Players whose first nationality is not in the table
+	if g.unknownPolicySelect != nil {
+		policy := mapper.UnknownNationPolicy(g.unknownPolicySelect.Selected)
+		if err := resolver.SetUnknownNationPolicy(policy, mapper.Ethnic(g.unknownGroupSelect.Selected)); err != nil {
+			return nil, fmt.Errorf("error applying the unknown nationality policy:\n\n%v\n\nPlease select a default group in Settings", err)
+		}
+	}
+
+	// Apply ethnic rules, the resolver starts with the built-in table
+	if g.rulesPathEntry.Text != "" {
+		rules, err := mapper.LoadEthnicRules(g.rulesPathEntry.Text, groups)
+		if err != nil {
+			return nil, fmt.Errorf("error loading ethnic rules:\n\n%v", err)
+		}
+		resolver.SetRules(rules)
+
+		if g.logger != nil {
+			g.logger.Printf("Loaded %d ethnic rules from %s", len(rules), g.rulesPathEntry.Text)
+		}
+	}
+
+	return resolver, nil
+}
+
+// loadImagePool reads the folders of the ethnic groups in the image folder
+// and applies the fallback groups
+func (g *JaqenGUI) loadImagePool(groups *mapper.EthnicGroups) (*mapper.ImagePool, error) {
+	options := internal.ConfigPoolOptions(g.config, g.imgDirEntry.Text)
+	options.Groups = groups
+	imagePool, err := mapper.NewImagePoolWithOptions(g.imgDirEntry.Text, options)
+	if err != nil {
+		return nil, fmt.Errorf("error loading image pool: %w", err)
+	}
+
+	// Files left out of the pool are worth a look but do not stop the run
+	if g.logger != nil {
+		report := imagePool.Report()
+		g.logger.Printf("Image pool: %s", report)
+		for _, issue := range report.Invalid {
+			g.logger.Printf("Warning: invalid image %s", issue)
+		}
+		for _, issue := range report.Collisions {
+			g.logger.Printf("Warning: colliding image %s", issue)
+		}
+		for _, ethnic := range report.Missing {
+			g.logger.Printf("Warning: missing ethnic folder %s, its players use the fallback groups", groups.Folder(ethnic))
+		}
+	}
+
+	// Leave out all but one image of each near-duplicate group
+	if g.excludeDupesCheck != nil && g.excludeDupesCheck.Checked {
+		groups, issues, err := imagePool.FindDuplicates(internal.ConfigDuplicateThreshold(g.config))
+		if err != nil {
+			return nil, fmt.Errorf("error finding duplicate images:\n\n%v\n\nPlease check the duplicate_threshold of your config", err)
+		}
+		removed := imagePool.ExcludeDuplicates(groups)
+
+		if g.logger != nil {
+			g.logger.Printf("Excluded %d duplicate images in %d groups", removed, len(groups))
+			for _, issue := range issues {
+				g.logger.Printf("Warning: cannot hash image %s", issue)
+			}
+		}
+	}
+
+	// Apply fallback groups for missing or exhausted ethnic pools
+	if g.config.EthnicFallbacks != nil {
+		if err := imagePool.SetFallbacks(*g.config.EthnicFallbacks); err != nil {
+			return nil, fmt.Errorf("error applying ethnic fallbacks:\n\n%v\n\nPlease check the ethnic_fallbacks of your config", err)
+		}
+	}
+
+	// Steer players to faces by the tags of the metadata sidecars
+	if g.config.TagRules != nil {
+		if err := imagePool.SetTagRules(*g.config.TagRules); err != nil {
+			return nil, fmt.Errorf("error applying tag rules:\n\n%v\n\nPlease check the tag_rules of your config", err)
+		}
+	}
+
+	return imagePool, nil
+}
+
+// playerPins returns the player_overrides of the config, validated against
+// the ethnic groups of the run
+func (g *JaqenGUI) playerPins(groups *mapper.EthnicGroups) (map[mapper.PlayerID]mapper.PlayerPin, error) {
+	if g.config.PlayerOverrides == nil {
+		return nil, nil
+	}
+
+	pins, err := mapper.NewPlayerPins(*g.config.PlayerOverrides, groups)
+	if err != nil {
+		return nil, fmt.Errorf("error applying player overrides:\n\n%v\n\nPlease check the player_overrides of your config", err)
+	}
+	return pins, nil
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,6 +18,9 @@ import (
 	"fyne.io/fyne/v2/widget"
 
 	nativeDialog "github.com/sqweek/dialog"
+
+	internal "jaqen/internal"
+	mapper "jaqen/pkgs"
 )
 
 // createHeaderBar creates the application header with title and action buttons
@@ -100,10 +104,16 @@ func (g *JaqenGUI) createMainContent() *fyne.Container {
 	rtfLabel := widget.NewLabel("RTF Player File:")
 	rtfLabel.TextStyle.Bold = true
 	g.rtfPathEntry = widget.NewEntry()
-	g.rtfPathEntry.SetPlaceHolder("Will be auto-detected from image folder...")
+	g.rtfPathEntry.SetPlaceHolder("Will be auto-detected from image folder... (separate multiple files or globs with ;)")
 	g.rtfPathEntry.OnChanged = func(_ string) { g.autoSaveConfig() }
 	rtfButton := g.createFileSelector(g.rtfPathEntry, "Select RTF File", "rtf")
 
+	encodingLabel := widget.NewLabel("RTF Encoding:")
+	encodingLabel.TextStyle.Bold = true
+	g.encodingSelect = widget.NewSelect([]string{mapper.EncodingAuto, "utf-8", "utf-16le", "utf-16be", "windows-1252"}, nil)
+	g.encodingSelect.SetSelected(mapper.EncodingAuto)
+	g.encodingSelect.OnChanged = func(_ string) { g.autoSaveConfig() }
+
 	// FM Version (Step 3)
 	fmVersionLabel := widget.NewLabel("Football Manager Version:")
 	fmVersionLabel.TextStyle.Bold = true
@@ -122,14 +132,76 @@ func (g *JaqenGUI) createMainContent() *fyne.Container {
 	g.runButton = widget.NewButton("Assign Face Mappings", g.runProcessing)
 	g.runButton.Importance = widget.HighImportance
 
+	explainButton := widget.NewButton("Explain Player...", g.showExplainDialog)
+	nationsButton := widget.NewButton("Check Nations...", g.showNationCheck)
+
 	// Initialize settings widgets
 	g.preserveCheck = widget.NewCheck("Preserve existing mappings", nil)
 	g.preserveCheck.SetChecked(true)
 	g.preserveCheck.OnChanged = func(_ bool) { g.autoSaveConfig() }
 
+	strategies := make([]string, 0, len(mapper.SelectionStrategies))
+	for _, strategy := range mapper.SelectionStrategies {
+		strategies = append(strategies, string(strategy))
+	}
+	strategyLabel := widget.NewLabel("Duplicate Selection:")
+	g.strategySelect = widget.NewSelect(strategies, func(_ string) { g.autoSaveConfig() })
+	g.strategySelect.SetSelected(string(mapper.SelectRandom))
+
+	maxUsesLabel := widget.NewLabel("Max Uses per Image:")
+	g.maxUsesEntry = widget.NewEntry()
+	g.maxUsesEntry.SetPlaceHolder("No limit")
+	g.maxUsesEntry.Validator = func(text string) error {
+		if _, err := parseMaxUses(text); err != nil {
+			return err
+		}
+		return nil
+	}
+	g.maxUsesEntry.OnChanged = func(_ string) { g.autoSaveConfig() }
+
 	g.allowDuplicateCheck = widget.NewCheck("Allow duplicate mappings", nil)
 	g.allowDuplicateCheck.SetChecked(true)
-	g.allowDuplicateCheck.OnChanged = func(_ bool) { g.autoSaveConfig() }
+	g.allowDuplicateCheck.OnChanged = func(allowDuplicate bool) {
+		// the strategy only picks among images given out several times
+		if allowDuplicate {
+			g.strategySelect.Enable()
+			g.maxUsesEntry.Enable()
+		} else {
+			g.strategySelect.Disable()
+			g.maxUsesEntry.Disable()
+		}
+		g.autoSaveConfig()
+	}
+
+	g.excludeDupesCheck = widget.NewCheck("Exclude near-duplicate images", nil)
+	g.excludeDupesCheck.OnChanged = func(_ bool) { g.autoSaveConfig() }
+
+	rulesLabel := widget.NewLabel("Ethnic Rules File:")
+	g.rulesPathEntry = widget.NewEntry()
+	g.rulesPathEntry.SetPlaceHolder("Optional TOML rule table, built-in rules are used when empty")
+	g.rulesPathEntry.OnChanged = func(_ string) { g.autoSaveConfig() }
+	rulesButton := g.createFileSelector(g.rulesPathEntry, "Select Rules File", "toml")
+
+	unknownPolicyLabel := widget.NewLabel("Unknown Nationality:")
+	policies := make([]string, 0, len(mapper.UnknownNationPolicies))
+	for _, policy := range mapper.UnknownNationPolicies {
+		policies = append(policies, string(policy))
+	}
+	g.unknownPolicySelect = widget.NewSelect(policies, nil)
+	g.unknownPolicySelect.SetSelected(string(mapper.UnknownNationStrict))
+
+	g.unknownGroupSelect = widget.NewSelect(g.ethnicOptions(), func(_ string) { g.autoSaveConfig() })
+	g.unknownGroupSelect.PlaceHolder = "Default group"
+	g.unknownGroupSelect.Disable()
+
+	g.unknownPolicySelect.OnChanged = func(policy string) {
+		if policy == string(mapper.UnknownNationDefaultGroup) {
+			g.unknownGroupSelect.Enable()
+		} else {
+			g.unknownGroupSelect.Disable()
+		}
+		g.autoSaveConfig()
+	}
 
 	// Create image preview cards with better styling - no titles
 	g.imagePreview1 = widget.NewCard("", "", widget.NewLabel("No folder selected"))
@@ -147,6 +219,7 @@ func (g *JaqenGUI) createMainContent() *fyne.Container {
 		widget.NewSeparator(),
 		container.NewBorder(nil, nil, xmlLabel, xmlButton, g.xmlPathEntry),
 		container.NewBorder(nil, nil, rtfLabel, rtfButton, g.rtfPathEntry),
+		container.NewBorder(nil, nil, encodingLabel, nil, g.encodingSelect),
 		container.NewBorder(nil, nil, fmVersionLabel, nil, g.fmVersionSelect),
 	))
 
@@ -164,6 +237,11 @@ func (g *JaqenGUI) createMainContent() *fyne.Container {
 	settingsCard := widget.NewCard("Settings", "", container.NewVBox(
 		g.preserveCheck,
 		g.allowDuplicateCheck,
+		container.NewBorder(nil, nil, strategyLabel, nil, g.strategySelect),
+		container.NewBorder(nil, nil, maxUsesLabel, nil, g.maxUsesEntry),
+		g.excludeDupesCheck,
+		container.NewBorder(nil, nil, rulesLabel, rulesButton, g.rulesPathEntry),
+		container.NewBorder(nil, nil, unknownPolicyLabel, g.unknownGroupSelect, g.unknownPolicySelect),
 		widget.NewSeparator(),
 		g.createMappingOverrideSection(),
 	))
@@ -181,7 +259,7 @@ func (g *JaqenGUI) createMainContent() *fyne.Container {
 		logAccordion,
 		widget.NewSeparator(),
 		g.progressBar,
-		container.NewCenter(g.runButton),
+		container.NewCenter(container.NewHBox(g.runButton, explainButton, nationsButton)),
 	))
 
 	return container.NewVBox(
@@ -223,7 +301,7 @@ func (g *JaqenGUI) createMappingOverrideSection() *fyne.Container {
 
 			if id < len(countries) {
 				country := countries[id]
-				ethnic := g.mappingOverrides[country]
+				ethnic := overrideLabel(g.mappingOverrides[country])
 
 				// Set country code label (left)
 				countryLabel := container.Objects[0].(*widget.Label)
@@ -250,16 +328,49 @@ func (g *JaqenGUI) createMappingOverrideSection() *fyne.Container {
 
 	addButton := widget.NewButton("Add Mapping Override", g.addMappingOverride)
 
+	g.availableEthnicsLabel = widget.NewLabel(g.availableEthnicsText())
+
 	return container.NewVBox(
 		widget.NewCard("Mapping Overrides", "", container.NewVBox(
 			widget.NewLabel("Country Code → Ethnic Group"),
-			widget.NewLabel("Add custom mappings for countries not recognized by default.\nAvailable ethnicities: African, Asian, Caucasian, Central European, EECA, Italmed, MENA, MESA, SAMed, Scandinavian, Seasian, South American, SpanMed, YugoGreek"),
+			g.availableEthnicsLabel,
 			g.mappingOverrideList,
 			addButton,
 		)),
 	)
 }
 
+// availableEthnicsText describes the mapping overrides, listing every built-in
+// and user-defined ethnic group
+func (g *JaqenGUI) availableEthnicsText() string {
+	return fmt.Sprintf("Add custom mappings for countries not recognized by default.\nAvailable ethnicities: %s\nUse weighted groups to mix looks, or a code such as FRA:0 to override a single ethnic value.", strings.Join(g.ethnicOptions(), ", "))
+}
+
+// ethnicOptions lists every built-in and user-defined ethnic group for selects
+func (g *JaqenGUI) ethnicOptions() []string {
+	// groups that do not validate leave the built-in ones
+	groups, _ := g.ethnicGroups()
+
+	ethnics := make([]string, 0)
+	for _, ethnic := range groups.All() {
+		ethnics = append(ethnics, string(ethnic))
+	}
+	return ethnics
+}
+
+// overrideLabel formats a mapping override value for display
+func overrideLabel(override any) string {
+	if ethnic, isSingle := override.(string); isSingle {
+		return ethnic
+	}
+
+	weights, err := mapper.ToEthnicWeights(override)
+	if err != nil {
+		return fmt.Sprintf("%v", override)
+	}
+	return weights.String()
+}
+
 // updateMappingOverrideList refreshes the mapping override list
 func (g *JaqenGUI) updateMappingOverrideList() {
 	if g.mappingOverrideList != nil {
@@ -276,32 +387,50 @@ func (g *JaqenGUI) addMappingOverride() {
 func (g *JaqenGUI) editMappingOverride(country, ethnic string) {
 	countryEntry := widget.NewEntry()
 	countryEntry.SetText(country)
-	countryEntry.SetPlaceHolder("Country Code (e.g., ENG)")
+	countryEntry.SetPlaceHolder("Country Code (e.g., ENG or FRA:0)")
 
-	// Get all available ethnicities from the mapper package
-	availableEthnicities := []string{
-		"African", "Asian", "Caucasian", "Central European", "EECA",
-		"Italmed", "MENA", "MESA", "SAMed", "Scandinavian",
-		"Seasian", "South American", "SpanMed", "YugoGreek",
-	}
+	weightsEntry := widget.NewEntry()
+	weightsEntry.SetPlaceHolder("Optional, e.g. Italmed=0.7, SpanMed=0.3")
 
-	ethnicSelect := widget.NewSelect(availableEthnicities, nil)
+	// Get all available ethnicities from the mapper package
+	ethnicSelect := widget.NewSelect(g.ethnicOptions(), nil)
 	ethnicSelect.SetSelected(ethnic)
 
 	form := &widget.Form{
 		Items: []*widget.FormItem{
 			{Text: "Country Code", Widget: countryEntry},
 			{Text: "Ethnic Group", Widget: ethnicSelect},
+			{Text: "Weighted Groups", Widget: weightsEntry},
 		},
 	}
 
 	targetWindow := g.window
 
 	dialog.ShowForm("Edit Mapping Override", "Save", "Cancel", form.Items, func(confirmed bool) {
-		if confirmed && countryEntry.Text != "" && ethnicSelect.Selected != "" {
+		if confirmed && countryEntry.Text != "" && weightsEntry.Text != "" {
+			groups, _ := g.ethnicGroups()
+			weights, err := mapper.ParseEthnicWeights(weightsEntry.Text, groups)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("invalid weighted groups: %w", err), targetWindow)
+				return
+			}
+
+			// Store weights in the same shape as they are read from config files
+			override := make(map[string]any)
+			for ethnic, weight := range weights {
+				override[string(ethnic)] = weight
+			}
+
+			if g.mappingOverrides == nil {
+				g.mappingOverrides = make(map[string]any)
+			}
+			g.mappingOverrides[countryEntry.Text] = override
+			g.updateMappingOverrideList()
+			g.autoSaveConfig()
+		} else if confirmed && countryEntry.Text != "" && ethnicSelect.Selected != "" {
 			// Ensure mappingOverrides map is initialized
 			if g.mappingOverrides == nil {
-				g.mappingOverrides = make(map[string]string)
+				g.mappingOverrides = make(map[string]any)
 			}
 			g.mappingOverrides[countryEntry.Text] = ethnicSelect.Selected
 			g.updateMappingOverrideList()
@@ -376,34 +505,32 @@ func (g *JaqenGUI) createFileSelector(entry *widget.Entry, title string, fileTyp
 	})
 }
 
-// findRandomImages finds random images in the specified directory
+// findRandomImages finds random images in the specified directory. The
+// images of a readable pool come from its index, other folders are walked
 func (g *JaqenGUI) findRandomImages(imgDir string) []string {
 	var imageFiles []string
 
-	// Supported image extensions
-	extensions := []string{".png", ".jpg", ".jpeg", ".gif", ".bmp"}
-
-	// Walk through the directory and subdirectories
-	err := filepath.Walk(imgDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Skip files we can't access
+	if imagePool, err := mapper.NewImagePoolWithOptions(imgDir, internal.ConfigPoolOptions(g.config, imgDir)); err == nil {
+		for _, info := range imagePool.Report().Images {
+			imageFiles = append(imageFiles, filepath.Join(imgDir, filepath.FromSlash(info.File)))
 		}
+	} else {
+		// Walk through the directory and subdirectories
+		err := filepath.Walk(imgDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil // Skip files we can't access
+			}
 
-		if !info.IsDir() {
-			ext := strings.ToLower(filepath.Ext(path))
-			for _, supportedExt := range extensions {
-				if ext == supportedExt {
-					imageFiles = append(imageFiles, path)
-					break
-				}
+			if !info.IsDir() && mapper.IsImageFile(path) {
+				imageFiles = append(imageFiles, path)
 			}
-		}
-		return nil
-	})
+			return nil
+		})
 
-	if err != nil {
-		log.Printf("Error walking directory: %v", err)
-		return []string{}
+		if err != nil {
+			log.Printf("Error walking directory: %v", err)
+			return []string{}
+		}
 	}
 
 	// Shuffle the images and return up to 3
@@ -496,3 +623,17 @@ func (g *JaqenGUI) updateImagePreviews(imgDir string) {
 		}
 	}
 }
+
+// parseMaxUses reads the max uses per image entry, empty meaning no limit
+func parseMaxUses(text string) (int, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, nil
+	}
+
+	maxUses, err := strconv.Atoi(text)
+	if err != nil || maxUses < 0 {
+		return 0, fmt.Errorf("max uses per image must be a positive number")
+	}
+	return maxUses, nil
+}
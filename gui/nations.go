@@ -0,0 +1,115 @@
+package gui
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	mapper "jaqen/pkgs"
+)
+
+// showNationCheck reports the nations of the player files and their mapping
+func (g *JaqenGUI) showNationCheck() {
+	if g.rtfPathEntry.Text == "" {
+		dialog.ShowError(fmt.Errorf("RTF file path is required"), g.window)
+		return
+	}
+
+	go g.checkNations()
+}
+
+// checkNations reads the nations of the player files with the current
+// settings and shows them with the suggested mapping overrides
+func (g *JaqenGUI) checkNations() {
+	resolver, err := g.newResolver()
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(err, g.window)
+		})
+		return
+	}
+
+	rtfFiles, err := mapper.ExpandPlayerFiles(mapper.SplitPlayerFiles(g.rtfPathEntry.Text))
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(fmt.Errorf("error finding player files: %w", err), g.window)
+		})
+		return
+	}
+
+	coverages, err := mapper.CheckNationCoverage(resolver, rtfFiles, g.encodingSelect.Selected)
+	if err != nil {
+		fyne.Do(func() {
+			dialog.ShowError(fmt.Errorf("error reading players: %w", err), g.window)
+		})
+		return
+	}
+
+	lines := make([]string, 0, len(coverages))
+	suggestions := make(map[string]mapper.Ethnic)
+	unmapped := 0
+	for _, coverage := range coverages {
+		if !coverage.Mapped() {
+			unmapped++
+		}
+
+		switch {
+		case !coverage.Mapped() && coverage.Region != "":
+			suggestions[coverage.Nation] = coverage.Suggestion
+			lines = append(lines, fmt.Sprintf("%-4s %6d  UNMAPPED, suggested %s from %s", coverage.Nation, coverage.Players, coverage.Suggestion, coverage.Region))
+		case !coverage.Mapped() && coverage.Suggestion != "":
+			suggestions[coverage.Nation] = coverage.Suggestion
+			lines = append(lines, fmt.Sprintf("%-4s %6d  UNMAPPED, suggested %s", coverage.Nation, coverage.Players, coverage.Suggestion))
+		case !coverage.Mapped():
+			lines = append(lines, fmt.Sprintf("%-4s %6d  UNMAPPED", coverage.Nation, coverage.Players))
+		case coverage.Weights != nil:
+			lines = append(lines, fmt.Sprintf("%-4s %6d  %s (%s)", coverage.Nation, coverage.Players, coverage.Ethnic, coverage.Weights))
+		default:
+			lines = append(lines, fmt.Sprintf("%-4s %6d  %s", coverage.Nation, coverage.Players, coverage.Ethnic))
+		}
+	}
+
+	snippet := mapper.MappingOverrideSnippet(coverages)
+	if g.logger != nil {
+		g.logger.Printf("Checked %d nations, %d unmapped", len(coverages), unmapped)
+	}
+
+	fyne.Do(func() {
+		report := widget.NewLabel(strings.Join(lines, "\n"))
+		report.TextStyle = fyne.TextStyle{Monospace: true}
+
+		scroll := container.NewScroll(report)
+		scroll.SetMinSize(fyne.NewSize(600, 350))
+
+		if snippet == "" {
+			dialog.NewCustom("Nation Check", "Close", scroll, g.window).Show()
+			return
+		}
+
+		copyButton := widget.NewButton("Copy Override Snippet", func() {
+			g.window.Clipboard().SetContent(snippet)
+		})
+
+		applyButton := widget.NewButton(fmt.Sprintf("Add %d Suggested Overrides", len(suggestions)), func() {
+			if g.mappingOverrides == nil {
+				g.mappingOverrides = make(map[string]any)
+			}
+			for nation, ethnic := range suggestions {
+				g.mappingOverrides[nation] = string(ethnic)
+			}
+			g.updateMappingOverrideList()
+			g.autoSaveConfig()
+		})
+		applyButton.Importance = widget.HighImportance
+		if len(suggestions) == 0 {
+			applyButton.Disable()
+		}
+
+		content := container.NewBorder(nil, container.NewHBox(applyButton, copyButton), nil, nil, scroll)
+		dialog.NewCustom("Nation Check", "Close", content, g.window).Show()
+	})
+}
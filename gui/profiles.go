@@ -3,11 +3,14 @@ package gui
 import (
 	"fmt"
 	"path/filepath"
+	"slices"
+	"strconv"
 
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 
 	internal "jaqen/internal"
+	mapper "jaqen/pkgs"
 )
 
 // initializeProfiles sets up the profile manager and auto-creates profiles for FM installations
@@ -145,6 +148,23 @@ func (g *JaqenGUI) updateConfigFromGUI() {
 		allowDuplicate := g.allowDuplicateCheck.Checked
 		g.config.AllowDuplicate = &allowDuplicate
 	}
+	if g.strategySelect != nil {
+		imageStrategy := g.strategySelect.Selected
+		g.config.ImageStrategy = &imageStrategy
+	}
+	if g.maxUsesEntry != nil {
+		if maxUses, err := parseMaxUses(g.maxUsesEntry.Text); err == nil {
+			g.config.MaxUses = &maxUses
+		}
+	}
+	if g.excludeDupesCheck != nil {
+		excludeDupes := g.excludeDupesCheck.Checked
+		g.config.ExcludeDupes = &excludeDupes
+	}
+	if g.encodingSelect != nil {
+		rtfEncoding := g.encodingSelect.Selected
+		g.config.RTFEncoding = &rtfEncoding
+	}
 	if g.fmVersionSelect != nil {
 		fmVersion := g.fmVersionSelect.Selected
 		g.config.FMVersion = &fmVersion
@@ -161,6 +181,16 @@ func (g *JaqenGUI) updateConfigFromGUI() {
 		imgPath := g.imgDirEntry.Text
 		g.config.IMGPath = &imgPath
 	}
+	if g.rulesPathEntry != nil {
+		rulesPath := g.rulesPathEntry.Text
+		g.config.RulesPath = &rulesPath
+	}
+	if g.unknownPolicySelect != nil {
+		unknownPolicy := g.unknownPolicySelect.Selected
+		g.config.UnknownNation = &unknownPolicy
+		unknownGroup := g.unknownGroupSelect.Selected
+		g.config.UnknownGroup = &unknownGroup
+	}
 	g.config.MappingOverride = &g.mappingOverrides
 }
 
@@ -285,9 +315,43 @@ func (g *JaqenGUI) applyConfigToGUI() {
 	if g.allowDuplicateCheck != nil && g.config.AllowDuplicate != nil {
 		g.allowDuplicateCheck.SetChecked(*g.config.AllowDuplicate)
 	}
+	if g.strategySelect != nil {
+		imageStrategy := mapper.SelectRandom
+		if g.config.ImageStrategy != nil {
+			strategy, err := mapper.ParseSelectionStrategy(*g.config.ImageStrategy)
+			if err != nil && g.logger != nil {
+				g.logger.Printf("Warning: %v, using random", err)
+			}
+			if err == nil {
+				imageStrategy = strategy
+			}
+		}
+		g.strategySelect.SetSelected(string(imageStrategy))
+	}
+	if g.maxUsesEntry != nil {
+		maxUses := ""
+		if g.config.MaxUses != nil && *g.config.MaxUses > 0 {
+			maxUses = strconv.Itoa(*g.config.MaxUses)
+		}
+		g.maxUsesEntry.SetText(maxUses)
+	}
+	if g.excludeDupesCheck != nil {
+		g.excludeDupesCheck.SetChecked(g.config.ExcludeDupes != nil && *g.config.ExcludeDupes)
+	}
 	if g.fmVersionSelect != nil && g.config.FMVersion != nil {
 		g.fmVersionSelect.SetSelected(*g.config.FMVersion)
 	}
+	if g.encodingSelect != nil {
+		if g.config.RTFEncoding != nil && *g.config.RTFEncoding != "" {
+			// keep encodings typed into the config file selectable
+			if !slices.Contains(g.encodingSelect.Options, *g.config.RTFEncoding) {
+				g.encodingSelect.Options = append(g.encodingSelect.Options, *g.config.RTFEncoding)
+			}
+			g.encodingSelect.SetSelected(*g.config.RTFEncoding)
+		} else {
+			g.encodingSelect.SetSelected(mapper.EncodingAuto)
+		}
+	}
 
 	// Apply paths - always update, even if empty
 	if g.xmlPathEntry != nil && g.config.XMLPath != nil {
@@ -304,17 +368,47 @@ func (g *JaqenGUI) applyConfigToGUI() {
 		}
 	}
 
+	if g.rulesPathEntry != nil {
+		rulesPath := ""
+		if g.config.RulesPath != nil {
+			rulesPath = *g.config.RulesPath
+		}
+		g.rulesPathEntry.SetText(rulesPath)
+	}
+
+	// Check the ethnic groups the override editor offers
+	if _, err := g.ethnicGroups(); err != nil && g.logger != nil {
+		g.logger.Printf("Warning: Failed to apply ethnic groups: %v", err)
+	}
+	if g.availableEthnicsLabel != nil {
+		g.availableEthnicsLabel.SetText(g.availableEthnicsText())
+	}
+
+	if g.unknownPolicySelect != nil {
+		unknownPolicy := string(mapper.UnknownNationStrict)
+		if g.config.UnknownNation != nil && *g.config.UnknownNation != "" {
+			unknownPolicy = *g.config.UnknownNation
+		}
+		unknownGroup := ""
+		if g.config.UnknownGroup != nil {
+			unknownGroup = *g.config.UnknownGroup
+		}
+		g.unknownGroupSelect.SetOptions(g.ethnicOptions())
+		g.unknownGroupSelect.SetSelected(unknownGroup)
+		g.unknownPolicySelect.SetSelected(unknownPolicy)
+	}
+
 	// Apply mapping overrides
 	if g.config.MappingOverride != nil {
 		// Copy the mapping overrides from config to GUI map
-		g.mappingOverrides = make(map[string]string)
+		g.mappingOverrides = make(map[string]any)
 		for k, v := range *g.config.MappingOverride {
 			g.mappingOverrides[k] = v
 		}
 		g.updateMappingOverrideList()
 	} else {
 		// Clear mapping overrides if none in config
-		g.mappingOverrides = make(map[string]string)
+		g.mappingOverrides = make(map[string]any)
 		g.updateMappingOverrideList()
 	}
 
@@ -326,6 +420,13 @@ func (g *JaqenGUI) applyConfigToGUI() {
 	}
 }
 
+// ethnicGroups returns the built-in ethnic groups and the user-defined ones
+// of the config. Every run reads its own, so that switching profiles never
+// changes the groups of a run
+func (g *JaqenGUI) ethnicGroups() (*mapper.EthnicGroups, error) {
+	return internal.ConfigEthnicGroups(g.config)
+}
+
 // ptrToStr converts a string pointer to string for logging
 func ptrToStr(s *string) string {
 	if s == nil {
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	mapper "jaqen/pkgs"
+)
+
+// GetUserNationsDir returns the directory holding imported nation tables
+func GetUserNationsDir() (string, error) {
+	configDir, err := GetUserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	nationsDir := filepath.Join(configDir, "nations")
+	if err := os.MkdirAll(nationsDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create nations directory: %w", err)
+	}
+
+	return nationsDir, nil
+}
+
+// nationTablePath returns where the imported table of an FM version is stored
+func nationTablePath(version string) (string, error) {
+	if version == "" || strings.ContainsAny(version, `/\.`) {
+		return "", fmt.Errorf("invalid FM version %q", version)
+	}
+
+	nationsDir, err := GetUserNationsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(nationsDir, version+".toml"), nil
+}
+
+// LoadNationTable returns the nation table of an FM version, the imported one
+// when there is one and the built-in one otherwise. Imported tables may map
+// nations to the given user-defined groups
+func LoadNationTable(version string, groups *mapper.EthnicGroups) (mapper.NationTable, error) {
+	if version == "" {
+		version = DefaultFMVersion
+	}
+
+	tablePath, err := nationTablePath(version)
+	if err != nil {
+		return mapper.NationTable{}, err
+	}
+
+	data, err := os.ReadFile(tablePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return mapper.BuiltinNationTable(version)
+	}
+	if err != nil {
+		return mapper.NationTable{}, err
+	}
+
+	table, err := mapper.ParseNationTable(data, "toml", groups)
+	if err != nil {
+		return mapper.NationTable{}, fmt.Errorf("imported nation table %s: %w", tablePath, err)
+	}
+
+	return table, nil
+}
+
+// ImportNationTable validates a TOML or JSON nation table and stores it for
+// its FM version, or for version when given. It returns where it was stored
+func ImportNationTable(path string, version string, groups *mapper.EthnicGroups) (mapper.NationTable, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return mapper.NationTable{}, "", err
+	}
+
+	table, err := mapper.ParseNationTable(data, mapper.NationTableFormat(path), groups)
+	if err != nil {
+		return mapper.NationTable{}, "", err
+	}
+	if version != "" {
+		table.Version = version
+	}
+
+	tablePath, err := nationTablePath(table.Version)
+	if err != nil {
+		return mapper.NationTable{}, "", err
+	}
+
+	tableBytes, err := mapper.MarshalNationTable(table, "toml")
+	if err != nil {
+		return mapper.NationTable{}, "", err
+	}
+
+	if err := os.WriteFile(tablePath, tableBytes, 0644); err != nil {
+		return mapper.NationTable{}, "", err
+	}
+
+	return table, tablePath, nil
+}
+
+// RemoveNationTable deletes the imported table of an FM version so that the
+// built-in one is used again
+func RemoveNationTable(version string) error {
+	tablePath, err := nationTablePath(version)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(tablePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -66,3 +68,20 @@ func GetUserLogPath() (string, error) {
 	}
 	return filepath.Join(configDir, "jaqen.log"), nil
 }
+
+// GetPoolIndexPath returns the path of the index cached for an image folder,
+// one file per folder in the pool-index directory of the user config dir
+func GetPoolIndexPath(imgPath string) (string, error) {
+	configDir, err := GetUserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	absPath, err := filepath.Abs(imgPath)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(absPath))
+
+	return filepath.Join(configDir, "pool-index", hex.EncodeToString(sum[:])+".json"), nil
+}
@@ -168,7 +168,7 @@ func (pm *ProfileManager) CreateProfileForGame(name string, gamePath string) (*P
 			IMGPath:         &[]string{""}[0],
 			FMVersion:       &[]string{DefaultFMVersion}[0],
 			AllowDuplicate:  &[]bool{true}[0],
-			MappingOverride: &map[string]string{},
+			MappingOverride: &map[string]any{},
 		},
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -1,11 +1,30 @@
 package internal
 
+import mapper "jaqen/pkgs"
+
 type JaqenConfig struct {
-	Preserve        *bool              `field:"preserve" toml:"preserve"`
-	XMLPath         *string            `field:"xml_path" toml:"xml_path"`
-	RTFPath         *string            `field:"rtf_path" toml:"rtf_path"`
-	IMGPath         *string            `field:"img_path" toml:"img_path"`
-	FMVersion       *string            `field:"fm_version" toml:"fm_version"`
-	AllowDuplicate  *bool              `field:"allow_duplicate" toml:"allow_duplicate"`
-	MappingOverride *map[string]string `field:"mapping_override" toml:"mapping_override"`
+	Preserve        *bool                          `field:"preserve" toml:"preserve"`
+	XMLPath         *string                        `field:"xml_path" toml:"xml_path"`
+	RTFPath         *string                        `field:"rtf_path" toml:"rtf_path"`
+	RTFEncoding     *string                        `field:"rtf_encoding" toml:"rtf_encoding"`
+	IMGPath         *string                        `field:"img_path" toml:"img_path"`
+	PoolMaxDepth    *int                           `field:"pool_max_depth" toml:"pool_max_depth"`
+	PoolHidden      *bool                          `field:"pool_include_hidden" toml:"pool_include_hidden"`
+	PoolIndex       *bool                          `field:"pool_index" toml:"pool_index"`
+	PoolStrict      *bool                          `field:"pool_strict" toml:"pool_strict"`
+	ImageRoots      *[]mapper.ImageRoot            `field:"image_roots" toml:"image_roots"`
+	ExcludeDupes    *bool                          `field:"exclude_duplicates" toml:"exclude_duplicates"`
+	DupeThreshold   *int                           `field:"duplicate_threshold" toml:"duplicate_threshold"`
+	FMVersion       *string                        `field:"fm_version" toml:"fm_version"`
+	AllowDuplicate  *bool                          `field:"allow_duplicate" toml:"allow_duplicate"`
+	ImageStrategy   *string                        `field:"image_strategy" toml:"image_strategy"`
+	MaxUses         *int                           `field:"max_uses_per_image" toml:"max_uses_per_image"`
+	RulesPath       *string                        `field:"rules_path" toml:"rules_path"`
+	UnknownNation   *string                        `field:"unknown_nation_policy" toml:"unknown_nation_policy"`
+	UnknownGroup    *string                        `field:"unknown_nation_group" toml:"unknown_nation_group"`
+	MappingOverride *map[string]any                `field:"mapping_override" toml:"mapping_override"`
+	EthnicGroups    *map[string]mapper.EthnicGroup `field:"ethnic_groups" toml:"ethnic_groups"`
+	EthnicFallbacks *map[string][]string           `field:"ethnic_fallbacks" toml:"ethnic_fallbacks"`
+	PlayerOverrides *map[string]mapper.PlayerPin   `field:"player_overrides" toml:"player_overrides"`
+	TagRules        *[]mapper.TagRule              `field:"tag_rules" toml:"tag_rules"`
 }
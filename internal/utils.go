@@ -5,6 +5,8 @@ import (
 	"io"
 	"os"
 
+	mapper "jaqen/pkgs"
+
 	"github.com/pelletier/go-toml/v2"
 )
 
@@ -68,3 +70,44 @@ func WriteConfig(config JaqenConfig, filePath string) error {
 
 	return nil
 }
+
+// ConfigEthnicGroups returns the built-in ethnic groups and the user-defined
+// ones of the config
+func ConfigEthnicGroups(config JaqenConfig) (*mapper.EthnicGroups, error) {
+	if config.EthnicGroups == nil {
+		return nil, nil
+	}
+	return mapper.NewEthnicGroups(*config.EthnicGroups)
+}
+
+// ConfigPoolOptions returns how the image pool of the config is read from
+// imgPath. The pool index is kept in the user config dir unless disabled
+func ConfigPoolOptions(config JaqenConfig, imgPath string) mapper.PoolOptions {
+	options := mapper.PoolOptions{}
+	if config.PoolMaxDepth != nil {
+		options.MaxDepth = *config.PoolMaxDepth
+	}
+	if config.PoolHidden != nil {
+		options.IncludeHidden = *config.PoolHidden
+	}
+	if config.PoolStrict != nil {
+		options.Strict = *config.PoolStrict
+	}
+	if config.ImageRoots != nil {
+		options.Roots = *config.ImageRoots
+	}
+	if config.PoolIndex == nil || *config.PoolIndex {
+		// without a config dir the pool is read without an index
+		options.IndexPath, _ = GetPoolIndexPath(imgPath)
+	}
+	return options
+}
+
+// ConfigDuplicateThreshold returns the hash distance under which images of
+// the pool are duplicates
+func ConfigDuplicateThreshold(config JaqenConfig) int {
+	if config.DupeThreshold != nil {
+		return *config.DupeThreshold
+	}
+	return mapper.DefaultDuplicateThreshold
+}
@@ -0,0 +1,233 @@
+package mapper
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AssignOptions controls how AssignImages hands out images
+type AssignOptions struct {
+	Preserve       bool              // keep the image of players already in the mapping
+	AllowDuplicate bool              // allow an image to be given to several players
+	Strategy       SelectionStrategy // how duplicates are picked, random when empty
+	MaxUses        int               // players an image can be given to, counting the mapping, 0 for no cap
+	ImagePrefix    string            // path of the image root relative to the mapping file
+	Roots          []string          // additional image roots relative to the image root, see ImagePool.Roots
+	Groups         *EthnicGroups     // ethnic groups of the run, see ImagePool.Groups
+	Pins           map[PlayerID]PlayerPin
+	Progress       func(done int, total int)
+}
+
+// mappedPath returns the path of a pool image as written to the mapping
+func (options AssignOptions) mappedPath(image FilePath) FilePath {
+	return FilePath(filepath.Join(options.ImagePrefix, string(image)))
+}
+
+// AssignResult summarises a run of AssignImages
+type AssignResult struct {
+	Assigned  int                       // players given a new image
+	Preserved int                       // players keeping their existing image
+	Pinned    int                       // players with a pinned image or ethnic
+	Fallbacks map[Ethnic]map[Ethnic]int // players served by a fallback group, ex: Italmed => {SpanMed: 3}
+	Missing   []Ethnic                  // groups without an ethnic folder in the image root
+	PinErrors []error                   // pinned images that are not in the pool, still written to the mapping
+	Errors    []error                   // players left without an image
+}
+
+// FallbackCount returns the number of players served by a fallback group
+func (result AssignResult) FallbackCount() int {
+	count := 0
+	for _, served := range result.Fallbacks {
+		for _, players := range served {
+			count += players
+		}
+	}
+	return count
+}
+
+// String describes the result for logs and dialogs
+func (result AssignResult) String() string {
+	lines := []string{fmt.Sprintf("%d players assigned, %d preserved, %d pinned, %d without an image", result.Assigned, result.Preserved, result.Pinned, len(result.Errors))}
+
+	if len(result.PinErrors) > 0 {
+		lines = append(lines, fmt.Sprintf("%d pinned images are not in the image folder, their players show no face:", len(result.PinErrors)))
+		for _, err := range result.PinErrors {
+			lines = append(lines, fmt.Sprintf("  %v", err))
+		}
+	}
+
+	if len(result.Missing) > 0 {
+		missing := make([]string, len(result.Missing))
+		for i, ethnic := range result.Missing {
+			missing[i] = string(ethnic)
+		}
+		lines = append(lines, fmt.Sprintf("Missing ethnic folders, their players use the fallback groups: %s", strings.Join(missing, ", ")))
+	}
+
+	if count := result.FallbackCount(); count > 0 {
+		lines = append(lines, fmt.Sprintf("%d players served by a fallback group:", count))
+
+		ethnics := make([]string, 0, len(result.Fallbacks))
+		for ethnic := range result.Fallbacks {
+			ethnics = append(ethnics, string(ethnic))
+		}
+		sort.Strings(ethnics)
+
+		for _, ethnic := range ethnics {
+			served := result.Fallbacks[Ethnic(ethnic)]
+			fallbacks := make([]string, 0, len(served))
+			for fallback := range served {
+				fallbacks = append(fallbacks, string(fallback))
+			}
+			sort.Strings(fallbacks)
+
+			for _, fallback := range fallbacks {
+				lines = append(lines, fmt.Sprintf("  %s → %s: %d", ethnic, fallback, served[Ethnic(fallback)]))
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// RelativeImagePrefix returns the ImagePrefix of the image root for a
+// mapping file, empty when the mapping file lies in the image root
+func RelativeImagePrefix(xmlPath string, imgDir string) string {
+	rel := ""
+	imgDirPathAbs, _ := filepath.Abs(imgDir)
+	xmlFilePathAbs, _ := filepath.Abs(xmlPath)
+
+	if imgDirPathAbs != filepath.Dir(xmlFilePathAbs) {
+		rel, _ = filepath.Rel(filepath.Dir(xmlFilePathAbs), imgDirPathAbs)
+	}
+	return strings.TrimPrefix(rel, "./")
+}
+
+// AssignImages gives every player an image from the pool and records it in
+// the mapping. Players the pool cannot serve are reported in the result.
+// Pins are honoured whatever the preserve setting, pinned images are never
+// given to other players
+func AssignImages(mapping *Mapping, images *ImagePool, players []Player, options AssignOptions) AssignResult {
+	result := AssignResult{Fallbacks: make(map[Ethnic]map[Ethnic]int), Missing: images.report.Missing}
+	options.migrateLegacyPaths(mapping)
+
+	pinned := pinnedImages(options.Pins)
+	result.PinErrors = images.unknownPins(pinned)
+	images.reserveImages(pinned)
+
+	mappedPins := make(map[FilePath]PlayerID)
+	for image, id := range pinned {
+		mappedPins[options.mappedPath(image)] = id
+		mapping.MapToImage(id, options.mappedPath(image))
+	}
+
+	// without duplicates, images the mapping keeps giving out are taken
+	if !options.AllowDuplicate {
+		images.ExcludeImages(keptImages(mapping, players, mappedPins, options))
+	}
+
+	if options.tracksUsage() {
+		images.trackUsage(mapping, options)
+		defer images.stopUsage()
+	}
+
+	for i, player := range players {
+		if options.Progress != nil {
+			options.Progress(i, len(players))
+		}
+
+		pin, isPinned := options.Pins[player.ID]
+		if isPinned && pin.Image != "" {
+			result.Pinned++
+			continue
+		}
+		if isPinned {
+			player.Ethnic = pin.Ethnic
+			result.Pinned++
+		}
+
+		if options.Preserve && keepsImage(mapping, player, mappedPins, options) {
+			result.Preserved++
+			continue
+		}
+
+		// a replaced image is one use less for the balanced strategy and the cap
+		var released FilePath
+		if existing, exists := mapping.Image(player.ID); exists && images.usage != nil {
+			if image, inPool := options.poolPath(existing); inPool {
+				images.releaseImage(image)
+				released = image
+			}
+		}
+
+		imgPath, served, err := images.GetImagePath(player, !options.AllowDuplicate)
+		if err != nil {
+			// the player keeps the image of the mapping
+			if released != "" {
+				images.usage[released]++
+			}
+			result.Errors = append(result.Errors, fmt.Errorf("player %s: %w", player.ID, err))
+			continue
+		}
+
+		if served != player.Ethnic {
+			if result.Fallbacks[player.Ethnic] == nil {
+				result.Fallbacks[player.Ethnic] = make(map[Ethnic]int)
+			}
+			result.Fallbacks[player.Ethnic][served]++
+		}
+
+		mapping.MapToImage(player.ID, options.mappedPath(imgPath))
+		result.Assigned++
+	}
+
+	if options.Progress != nil {
+		options.Progress(len(players), len(players))
+	}
+
+	return result
+}
+
+// keepsImage reports whether a preserved player keeps the image of the
+// mapping. An image pinned to another player is taken back and a player
+// pinned to an ethnic only keeps an image of that ethnic's folder
+func keepsImage(mapping *Mapping, player Player, mappedPins map[FilePath]PlayerID, options AssignOptions) bool {
+	existing, exists := mapping.Image(player.ID)
+	if !exists {
+		return false
+	}
+
+	if owner, isPinned := mappedPins[existing]; isPinned && owner != player.ID {
+		return false
+	}
+
+	if pin, isPinned := options.Pins[player.ID]; isPinned {
+		image, inPool := options.poolPath(existing)
+		return inPool && strings.HasPrefix(string(options.rootImage(image)), options.Groups.Folder(pin.Ethnic)+"/")
+	}
+
+	return true
+}
+
+// keptImages returns the pool images of the mapping that stay given out
+// after a run: those of players outside of the run and of preserved players.
+// Images of players given a new image return to the pool
+func keptImages(mapping *Mapping, players []Player, mappedPins map[FilePath]PlayerID, options AssignOptions) []FilePath {
+	running := make(map[PlayerID]Player, len(players))
+	for _, player := range players {
+		running[player.ID] = player
+	}
+
+	kept := make([]FilePath, 0)
+	for id, image := range mapping.idImageMap {
+		if player, inRun := running[id]; inRun && !(options.Preserve && keepsImage(mapping, player, mappedPins, options)) {
+			continue
+		}
+		if poolImage, inPool := options.poolPath(image); inPool {
+			kept = append(kept, poolImage)
+		}
+	}
+	return kept
+}
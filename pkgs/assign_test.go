@@ -0,0 +1,448 @@
+package mapper
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssignImages_FallbackChain(t *testing.T) {
+	root := setupImageRoot(t,
+		"SpanMed/spanish.png",
+		"Central European/central.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := pool.SetFallbacks(map[string][]string{"Italmed": {"SpanMed", "Central European"}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	mapping := &Mapping{idImageMap: make(map[PlayerID]FilePath)}
+	players := []Player{
+		{ID: "1", Ethnic: ItalianMediterranean},
+		{ID: "2", Ethnic: ItalianMediterranean},
+		{ID: "3", Ethnic: ItalianMediterranean},
+	}
+
+	result := AssignImages(mapping, pool, players, AssignOptions{})
+
+	if mapping.idImageMap["1"] != "SpanMed/spanish" || mapping.idImageMap["2"] != "Central European/central" {
+		t.Fatalf("expected the fallback chain to be followed in order, got %v", mapping.idImageMap)
+	}
+	if result.Assigned != 2 || result.FallbackCount() != 2 || len(result.Errors) != 1 {
+		t.Fatalf("expected 2 players served by fallbacks and 1 error, got %+v", result)
+	}
+	if !strings.Contains(result.Errors[0].Error(), "ran out of images for ethnicity: Italmed") {
+		t.Fatalf("expected an out of images error, got %v", result.Errors[0])
+	}
+}
+
+func TestSetFallbacks_Invalid(t *testing.T) {
+	pool := &ImagePool{pool: make(map[Ethnic][]PoolImage)}
+
+	err := pool.SetFallbacks(map[string][]string{
+		"Italmed": {"Italmed", "Martian"},
+	})
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+
+	for _, expectedErrorMsg := range []string{
+		`fallbacks of "Italmed": a group cannot fall back to itself`,
+		`fallbacks of "Italmed": "Martian" is not valid ethnic`,
+	} {
+		if !strings.Contains(err.Error(), expectedErrorMsg) {
+			t.Fatalf("expected error message to contain %q, got %q", expectedErrorMsg, err.Error())
+		}
+	}
+}
+
+func TestAssignImages_Pins(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/face_0012.png",
+		"Asian/asian.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	pins, err := NewPlayerPins(map[string]PlayerPin{
+		"2000133469": {Image: "African/face_0012.png"},
+		"2000133376": {Ethnic: Asian},
+	}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{
+		"2000133469": "Asian/asian",
+		"2000133376": "African/face_0012",
+	}}
+	players := []Player{
+		{ID: "2000133469", Ethnic: Asian},
+		{ID: "2000133376", Ethnic: African},
+		{ID: "2000134233", Ethnic: African},
+	}
+
+	result := AssignImages(mapping, pool, players, AssignOptions{Preserve: true, AllowDuplicate: true, Pins: pins})
+
+	for id, expected := range map[PlayerID]FilePath{
+		"2000133469": "African/face_0012",
+		"2000133376": "Asian/asian",
+	} {
+		if mapping.idImageMap[id] != expected {
+			t.Fatalf("expected %s for player %s, got %s", expected, id, mapping.idImageMap[id])
+		}
+	}
+	if _, exists := mapping.idImageMap["2000134233"]; exists || len(result.Errors) != 1 {
+		t.Fatalf("expected the pinned image not to be handed out, got %v", mapping.idImageMap)
+	}
+	if result.Pinned != 2 || result.Preserved != 0 {
+		t.Fatalf("expected 2 pinned players and none preserved, got %+v", result)
+	}
+}
+
+func TestAssignImages_PinsOutsideRun(t *testing.T) {
+	pool, err := NewImagePool(setupImageRoot(t, "African/a.png", "African/b.png"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// only player 1 is in the exports of the run
+	pins, err := NewPlayerPins(map[string]PlayerPin{
+		"1": {Image: "African/a.png"},
+		"2": {Image: "African/b.png"},
+		"3": {Ethnic: Asian},
+	}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{}}
+	result := AssignImages(mapping, pool, []Player{{ID: "1", Ethnic: African}}, AssignOptions{Pins: pins})
+	if result.Pinned != 1 {
+		t.Fatalf("expected 1 pinned player, got %+v", result)
+	}
+	if mapping.idImageMap["2"] != "African/b" {
+		t.Fatalf("expected the pinned image of player 2 to be kept, got %v", mapping.idImageMap)
+	}
+}
+
+func TestAssignImages_UnknownPin(t *testing.T) {
+	pool, err := NewImagePool(setupImageRoot(t, "African/face_0012.png"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	pins, err := NewPlayerPins(map[string]PlayerPin{
+		"2000133469": {Image: "African/face_012"},
+		"2000133376": {Image: "African/face_0012"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{}}
+	result := AssignImages(mapping, pool, nil, AssignOptions{Pins: pins})
+
+	if len(result.PinErrors) != 1 || result.PinErrors[0].Error() != "player 2000133469: pinned image African/face_012 is not in the image folder" {
+		t.Fatalf("expected the mistyped pin to be reported, got %v", result.PinErrors)
+	}
+	if mapping.idImageMap["2000133469"] != "African/face_012" {
+		t.Fatalf("expected the pin to be written anyway, got %v", mapping.idImageMap)
+	}
+}
+
+func TestNewPlayerPins_Invalid(t *testing.T) {
+	_, err := NewPlayerPins(map[string]PlayerPin{
+		"abc":        {Ethnic: African},
+		"2000133469": {},
+		"2000133376": {Ethnic: "Martian"},
+		"2000134233": {Image: "African/face"},
+		"2000134505": {Image: "African/face.png"},
+	}, nil)
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+
+	for _, expectedErrorMsg := range []string{
+		`player override "abc" is not a player UID`,
+		`player override "2000133469" has neither an ethnic nor an image`,
+		`ethnic value "Martian" is not valid ethnic for player "2000133376"`,
+		`image "African/face" is pinned to both "2000134233" and "2000134505"`,
+	} {
+		if !strings.Contains(err.Error(), expectedErrorMsg) {
+			t.Fatalf("expected error message to contain %q, got %q", expectedErrorMsg, err.Error())
+		}
+	}
+}
+
+func TestAssignImages_Balanced(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/a.png",
+		"African/b.png",
+		"African/c.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// a is already given out by the mapping
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{"0": "faces/African/a"}}
+	players := []Player{}
+	for _, id := range []PlayerID{"1", "2", "3", "4", "5"} {
+		players = append(players, Player{ID: id, Ethnic: African})
+	}
+
+	result := AssignImages(mapping, pool, players, AssignOptions{
+		AllowDuplicate: true,
+		Strategy:       SelectBalanced,
+		ImagePrefix:    "faces",
+	})
+	if result.Assigned != 5 {
+		t.Fatalf("expected 5 players assigned, got %+v", result)
+	}
+
+	uses := make(map[FilePath]int)
+	for _, image := range mapping.AssignedImages() {
+		uses[image]++
+	}
+	for _, image := range []FilePath{"faces/African/a", "faces/African/b", "faces/African/c"} {
+		if uses[image] != 2 {
+			t.Fatalf("expected every image to be used twice, got %v", uses)
+		}
+	}
+	if pool.usage != nil {
+		t.Fatalf("expected usage tracking to stop after the run")
+	}
+}
+
+func TestAssignImages_MaxUses(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/a.png",
+		"African/b.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// a is already given out twice, the cap is reached
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{"0": "African/a", "00": "African/a"}}
+	players := []Player{
+		{ID: "1", Ethnic: African},
+		{ID: "2", Ethnic: African},
+		{ID: "3", Ethnic: African},
+	}
+
+	result := AssignImages(mapping, pool, players, AssignOptions{AllowDuplicate: true, MaxUses: 2})
+	if result.Assigned != 2 || len(result.Errors) != 1 {
+		t.Fatalf("expected 2 players assigned and 1 error, got %+v", result)
+	}
+	for _, id := range []PlayerID{"1", "2"} {
+		if mapping.idImageMap[id] != "African/b" {
+			t.Fatalf("expected player %s to get African/b, got %v", id, mapping.idImageMap)
+		}
+	}
+
+	report := UsageReport(mapping, pool, AssignOptions{})
+	if len(report) != 1 || report[0].Ethnic != African || report[0].Uses() != 4 {
+		t.Fatalf("expected 4 uses of African images, got %+v", report)
+	}
+	if usage := report[0].Images[0]; usage.Image != "African/a" || len(usage.Players) != 2 || usage.Players[0] != "0" {
+		t.Fatalf("expected African/a used by 0 and 00 first, got %+v", usage)
+	}
+}
+
+func TestAssignImages_MaxUsesBeforeAgeBands(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/age-15-19/young.png",
+		"African/any.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// once the young face is capped, the second player falls back to the unbanded one
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{}}
+	players := []Player{
+		{ID: "1", Ethnic: African, Age: 16},
+		{ID: "2", Ethnic: African, Age: 16},
+	}
+
+	result := AssignImages(mapping, pool, players, AssignOptions{AllowDuplicate: true, MaxUses: 1})
+	if result.Assigned != 2 || len(result.Errors) != 0 {
+		t.Fatalf("expected 2 players assigned, got %+v", result)
+	}
+	if mapping.idImageMap["1"] != "African/age-15-19/young" || mapping.idImageMap["2"] != "African/any" {
+		t.Fatalf("expected the young face then the unbanded one, got %v", mapping.idImageMap)
+	}
+}
+
+func TestAssignImages_BalancedToneBuckets(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/tone-1-5/a.png",
+		"African/tone-1-5/b.png",
+		"African/tone-15-20/c.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// c is unused, but only light players are in the run
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{"0": "African/tone-1-5/a"}}
+	players := []Player{
+		{ID: "1", Ethnic: African, SkinTone: 2},
+		{ID: "2", Ethnic: African, SkinTone: 2},
+		{ID: "3", Ethnic: African, SkinTone: 2},
+	}
+
+	result := AssignImages(mapping, pool, players, AssignOptions{AllowDuplicate: true, Strategy: SelectBalanced})
+	if result.Assigned != 3 {
+		t.Fatalf("expected 3 players assigned, got %+v", result)
+	}
+
+	// the least used faces are picked within the bucket of the skin tone
+	if mapping.idImageMap["1"] != "African/tone-1-5/b" {
+		t.Fatalf("expected player 1 to get the unused face of the bucket, got %v", mapping.idImageMap)
+	}
+	uses := make(map[FilePath]int)
+	for _, image := range mapping.AssignedImages() {
+		uses[image]++
+	}
+	if uses["African/tone-1-5/a"] != 2 || uses["African/tone-1-5/b"] != 2 || uses["African/tone-15-20/c"] != 0 {
+		t.Fatalf("expected the light faces to be used twice and c never, got %v", uses)
+	}
+}
+
+func TestAssignImages_BalancedAgeBands(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/age-15-19/a.png",
+		"African/age-15-19/b.png",
+		"African/any.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// a is capped, b has one use left and the unbanded face is unused
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{
+		"0":   "African/age-15-19/a",
+		"00":  "African/age-15-19/a",
+		"000": "African/age-15-19/b",
+	}}
+	players := []Player{
+		{ID: "1", Ethnic: African, Age: 16},
+		{ID: "2", Ethnic: African, Age: 16},
+		{ID: "3", Ethnic: African, Age: 16},
+		{ID: "4", Ethnic: African, Age: 16},
+	}
+
+	result := AssignImages(mapping, pool, players, AssignOptions{AllowDuplicate: true, Strategy: SelectBalanced, MaxUses: 2})
+	if result.Assigned != 3 || len(result.Errors) != 1 {
+		t.Fatalf("expected 3 players assigned and 1 error, got %+v", result)
+	}
+
+	// the age band wins over the least used face until it is capped
+	expected := map[PlayerID]FilePath{"1": "African/age-15-19/b", "2": "African/any", "3": "African/any"}
+	for id, image := range expected {
+		if mapping.idImageMap[id] != image {
+			t.Fatalf("expected player %s to get %s, got %v", id, image, mapping.idImageMap)
+		}
+	}
+}
+
+func TestAssignImages_NoDuplicateAcrossRuns(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/a.png",
+		"African/b.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// player 0 got African/a in an earlier run and is not in this one
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{"0": "faces/African/a"}}
+	players := []Player{
+		{ID: "1", Ethnic: African},
+		{ID: "2", Ethnic: African},
+	}
+
+	result := AssignImages(mapping, pool, players, AssignOptions{Preserve: true, ImagePrefix: "faces"})
+	if mapping.idImageMap["1"] != "faces/African/b" || result.Assigned != 1 || len(result.Errors) != 1 {
+		t.Fatalf("expected only African/b to be handed out, got %v %+v", mapping.idImageMap, result)
+	}
+
+	// without preserve, the image of a player in the run is handed out again
+	pool, err = NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	mapping = &Mapping{idImageMap: map[PlayerID]FilePath{"1": "faces/African/a", "0": "faces/African/b"}}
+
+	result = AssignImages(mapping, pool, players[:1], AssignOptions{ImagePrefix: "faces"})
+	if mapping.idImageMap["1"] != "faces/African/a" || result.Assigned != 1 {
+		t.Fatalf("expected player 1 to get African/a back, got %v %+v", mapping.idImageMap, result)
+	}
+}
+
+func TestRelativeImagePrefix(t *testing.T) {
+	base := t.TempDir()
+	faces := filepath.Join(base, "faces")
+
+	expected := map[string]string{
+		filepath.Join(faces, "config.xml"):      "",
+		filepath.Join(base, "config.xml"):       "faces",
+		filepath.Join(base, "fm", "config.xml"): filepath.Join("..", "faces"),
+	}
+	for xmlPath, prefix := range expected {
+		if got := RelativeImagePrefix(xmlPath, faces); got != prefix {
+			t.Fatalf("expected the prefix %q for %s, got %q", prefix, xmlPath, got)
+		}
+	}
+}
+
+func TestAssignImages_LegacyPrefix(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/a.png",
+		"African/b.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// an earlier version mapped player 0 relative to the mapping file itself
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{"0": "../faces/African/a"}}
+	options := AssignOptions{ImagePrefix: "faces"}
+
+	if report := UsageReport(mapping, pool, options); len(report) != 1 || report[0].Uses() != 1 {
+		t.Fatalf("expected the old path to count as a use of African/a, got %+v", report)
+	}
+
+	players := []Player{{ID: "1", Ethnic: African}, {ID: "2", Ethnic: African}}
+	result := AssignImages(mapping, pool, players, options)
+	if mapping.idImageMap["1"] != "faces/African/b" || result.Assigned != 1 || len(result.Errors) != 1 {
+		t.Fatalf("expected only African/b to be handed out, got %v %+v", mapping.idImageMap, result)
+	}
+	if mapping.idImageMap["0"] != "faces/African/a" {
+		t.Fatalf("expected the old path to be rewritten, got %s", mapping.idImageMap["0"])
+	}
+}
@@ -0,0 +1,152 @@
+package mapper
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SelectionStrategy decides which of the candidate images a player is given
+// when images may be given to several players
+type SelectionStrategy string
+
+const (
+	SelectRandom   SelectionStrategy = "random"   // any candidate
+	SelectBalanced SelectionStrategy = "balanced" // a least used candidate, every image of a tone bucket or age band is used once before any is used twice
+)
+
+// SelectionStrategies lists the strategies in the order they are offered
+var SelectionStrategies = []SelectionStrategy{SelectRandom, SelectBalanced}
+
+// ParseSelectionStrategy validates a strategy of the config, empty meaning random
+func ParseSelectionStrategy(strategy string) (SelectionStrategy, error) {
+	switch SelectionStrategy(strategy) {
+	case "", SelectRandom:
+		return SelectRandom, nil
+	case SelectBalanced:
+		return SelectBalanced, nil
+	}
+	return "", fmt.Errorf(`image selection strategy "%s" is not random or balanced`, strategy)
+}
+
+// poolPath returns the pool image of a path written to the mapping, false
+// when the path lies outside of the image root and its additional roots.
+// Paths written with the prefix of earlier versions are accepted, see
+// legacyPoolPath
+func (options AssignOptions) poolPath(mapped FilePath) (FilePath, bool) {
+	if image, inPool := prefixedPoolPath(options.ImagePrefix, options.Roots, mapped); inPool {
+		return image, true
+	}
+	return options.legacyPoolPath(mapped)
+}
+
+// legacyPoolPath returns the pool image of a path written with the prefix of
+// earlier versions, taken relative to the mapping file rather than to its
+// folder and so starting with one ".." too many, ex: ../faces/African/face
+func (options AssignOptions) legacyPoolPath(mapped FilePath) (FilePath, bool) {
+	if options.ImagePrefix == "" {
+		return "", false
+	}
+	return prefixedPoolPath(path.Join("..", filepath.ToSlash(options.ImagePrefix)), options.Roots, mapped)
+}
+
+// prefixedPoolPath returns the pool image of a path mapped with a prefix
+func prefixedPoolPath(prefix string, roots []string, mapped FilePath) (FilePath, bool) {
+	image, err := filepath.Rel(filepath.FromSlash(prefix), filepath.FromSlash(string(mapped)))
+	if err != nil {
+		return "", false
+	}
+	image = filepath.ToSlash(image)
+
+	if image != ".." && !strings.HasPrefix(image, "../") {
+		return FilePath(image), true
+	}
+	for _, root := range roots {
+		if strings.HasPrefix(image, root+"/") {
+			return FilePath(image), true
+		}
+	}
+	return "", false
+}
+
+// migrateLegacyPaths rewrites the paths of the mapping written with the
+// prefix of earlier versions, which FM cannot resolve, with the prefix of
+// the options
+func (options AssignOptions) migrateLegacyPaths(mapping *Mapping) {
+	for id, mapped := range mapping.idImageMap {
+		if _, inPool := prefixedPoolPath(options.ImagePrefix, options.Roots, mapped); inPool {
+			continue
+		}
+		if image, isLegacy := options.legacyPoolPath(mapped); isLegacy {
+			mapping.MapToImage(id, options.mappedPath(image))
+		}
+	}
+}
+
+// tracksUsage reports whether a run counts the players per image, which it
+// does whenever duplicates are allowed, whatever the strategy and cap: the
+// priority of the image roots needs the count too. Without duplicates every
+// image is given out once and needs no count
+func (options AssignOptions) tracksUsage() bool {
+	return options.AllowDuplicate
+}
+
+// trackUsage turns on the balanced strategy and the usage cap of the
+// options and counts the players of every image, starting from the images the mapping already gives out
+func (images *ImagePool) trackUsage(mapping *Mapping, options AssignOptions) {
+	images.balanced = options.Strategy == SelectBalanced
+	images.maxUses = options.MaxUses
+	images.usage = make(map[FilePath]int)
+	for _, mapped := range mapping.AssignedImages() {
+		if image, inPool := options.poolPath(mapped); inPool {
+			images.usage[image]++
+		}
+	}
+}
+
+// stopUsage turns off the balanced strategy and the usage cap
+func (images *ImagePool) stopUsage() {
+	images.usage = nil
+	images.balanced = false
+	images.maxUses = 0
+}
+
+// releaseImage forgets a use of an image, when its player is given another one
+func (images *ImagePool) releaseImage(image FilePath) {
+	if images.usage[image] > 0 {
+		images.usage[image]--
+	}
+}
+
+// leastUsed keeps the candidates given out to the fewest players
+func (images *ImagePool) leastUsed(ethnicPool []PoolImage, candidates []int) []int {
+	leastUsed := make([]int, 0, len(candidates))
+	least := -1
+	for _, index := range candidates {
+		uses := images.usage[ethnicPool[index].Path]
+		switch {
+		case least < 0 || uses < least:
+			least = uses
+			leastUsed = append(leastUsed[:0], index)
+		case uses == least:
+			leastUsed = append(leastUsed, index)
+		}
+	}
+	return leastUsed
+}
+
+// underCap keeps the candidates given out to fewer players than the cap
+func (images *ImagePool) underCap(ethnicPool []PoolImage, candidates []int) []int {
+	if images.maxUses <= 0 {
+		return candidates
+	}
+
+	available := make([]int, 0, len(candidates))
+	for _, index := range candidates {
+		if images.usage[ethnicPool[index].Path] < images.maxUses {
+			available = append(available, index)
+		}
+	}
+	return available
+}
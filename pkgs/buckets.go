@@ -0,0 +1,133 @@
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ValueRange is an inclusive range of player values, such as skin tones, that
+// a bucket of images is meant for. The zero value means "untagged"
+type ValueRange struct {
+	Min int
+	Max int
+}
+
+func (r ValueRange) IsSet() bool {
+	return r.Max > 0
+}
+
+func (r ValueRange) Contains(value int) bool {
+	return value >= r.Min && value <= r.Max
+}
+
+// Distance returns how far value lies outside of the range, 0 if inside
+func (r ValueRange) Distance(value int) int {
+	switch {
+	case value < r.Min:
+		return r.Min - value
+	case value > r.Max:
+		return value - r.Max
+	default:
+		return 0
+	}
+}
+
+func (r ValueRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// bucketRegex returns a regex matching tags such as "tone-7" or "tone-1-5",
+// either as a whole folder name or as a token of a file name separated by
+// "_", ".", " " or "-" such as "face_0012_tone-7"
+func bucketRegex(prefix string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`(?i)(?:^|[_. -])%s-(\d+)(?:-(\d+))?(?:$|[_. -])`, prefix))
+}
+
+var (
+	toneRegex = bucketRegex("tone")
+	ageRegex  = bucketRegex("age")
+)
+
+// parseBucket reads a range tag from a folder or file name
+func parseBucket(bucketRegex *regexp.Regexp, name string) (ValueRange, bool) {
+	matches := bucketRegex.FindStringSubmatch(name)
+	if matches == nil {
+		return ValueRange{}, false
+	}
+
+	low, _ := strconv.Atoi(matches[1])
+	high := low
+	if matches[2] != "" {
+		high, _ = strconv.Atoi(matches[2])
+	}
+	if high < low {
+		low, high = high, low
+	}
+
+	return ValueRange{Min: low, Max: high}, true
+}
+
+// ageCandidates narrows the candidates to the faces of an age band holding
+// the player's age, or else to the faces without a band so that older
+// players do not get the youthful ones. When neither is left, or the age is
+// unknown, the candidates are kept. The number of faces of a matching band
+// is returned too
+func ageCandidates(pool []PoolImage, candidates []int, age int) ([]int, int) {
+	if age <= 0 {
+		return candidates, 0
+	}
+
+	banded := make([]int, 0, len(candidates))
+	unbanded := make([]int, 0, len(candidates))
+	for _, index := range candidates {
+		switch band := pool[index].Age; {
+		case band.IsSet() && band.Contains(age):
+			banded = append(banded, index)
+		case !band.IsSet():
+			unbanded = append(unbanded, index)
+		}
+	}
+
+	switch {
+	case len(banded) > 0:
+		return banded, len(banded)
+	case len(unbanded) > 0:
+		return unbanded, 0
+	}
+	return candidates, 0
+}
+
+// closestBucket returns the indexes of the images whose range is closest to
+// value. When value is unknown or no image carries a range, nil is returned
+// so that callers fall back to the whole pool
+func closestBucket(ranges []ValueRange, value int) []int {
+	if value <= 0 {
+		return nil
+	}
+
+	best := -1
+	closest := make([]int, 0)
+	for index, valueRange := range ranges {
+		if !valueRange.IsSet() {
+			continue
+		}
+
+		distance := valueRange.Distance(value)
+		switch {
+		case best == -1 || distance < best:
+			best = distance
+			closest = append(closest[:0], index)
+		case distance == best:
+			closest = append(closest, index)
+		}
+	}
+
+	if len(closest) == 0 {
+		return nil
+	}
+	return closest
+}
@@ -38,7 +38,11 @@ var Ethnicities = [...]Ethnic{
 	YugoslavGreek,
 }
 
-var EthnicSet = mapset.NewSet[Ethnic]()
+// EthnicSet returns the built-in groups, see EthnicGroups.Set for the groups
+// of a run
+func EthnicSet() mapset.Set[Ethnic] {
+	return (*EthnicGroups)(nil).Set()
+}
 
 var NationEthnicMapping = map[string]Ethnic{
 	"AFG": MiddleEastSouthAsian,
@@ -286,9 +290,3 @@ var NationEthnicMapping = map[string]Ethnic{
 	"ZAN": African,
 	"ZIM": African,
 }
-
-func init() {
-	for _, ethnic := range Ethnicities {
-		EthnicSet.Add(ethnic)
-	}
-}
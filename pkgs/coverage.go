@@ -0,0 +1,175 @@
+package mapper
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// NationCoverage is how a nation code seen in the player files is mapped
+type NationCoverage struct {
+	Nation     string
+	Players    int           // players holding the nationality, first or second
+	Ethnic     Ethnic        // group of the nation, empty when unmapped
+	Weights    EthnicWeights // distribution of a weighted override, nil otherwise
+	Suggestion Ethnic        // suggested group of an unmapped nation, empty when there is none
+	Region     string        // region whose nations gave the suggestion, empty when it came from the other nationality
+}
+
+// Mapped reports whether the nation resolves to a group
+func (coverage NationCoverage) Mapped() bool {
+	return coverage.Ethnic != ""
+}
+
+// CheckNationCoverage lists every nation code of the player files with its
+// player count and its mapping, sorted by code. Players appearing in several
+// files are counted once, as GetPlayersFromFiles keeps the first row seen.
+// Unmapped nations are given the group most of the mapped nations of their
+// region resolve to as a suggestion. Ties, and nations of no known region, go
+// to the group most of their players' other nationality resolves to
+func CheckNationCoverage(resolver *Resolver, rtfPaths []string, encodingName string) ([]NationCoverage, error) {
+	counts := make(map[string]int)
+	neighbours := make(map[string]map[Ethnic]int) // groups of the other nationality, per unmapped nation
+	seen := make(map[PlayerID]bool)
+
+	countNeighbour := func(nation, other string) {
+		if _, mapped := resolver.Nation(nation); mapped {
+			return
+		}
+		ethnic, mapped := resolver.Nation(other)
+		if !mapped {
+			return
+		}
+		if neighbours[nation] == nil {
+			neighbours[nation] = make(map[Ethnic]int)
+		}
+		neighbours[nation][ethnic]++
+	}
+
+	for _, rtfPath := range rtfPaths {
+		rtfBytes, err := os.ReadFile(rtfPath)
+		if err != nil {
+			return nil, err
+		}
+
+		rtfBytes, err = DecodePlayerFile(rtfBytes, encodingName)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rtfPath, err)
+		}
+
+		rtfScanner := bufio.NewScanner(bytes.NewReader(rtfBytes))
+		for rtfScanner.Scan() {
+			id, rtfData, err := parsePlayerRow(rtfScanner.Text())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", rtfPath, err)
+			}
+			if rtfData == nil || seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			nationality1, nationality2 := rtfData[2], rtfData[3]
+			if nationality1 != "" {
+				counts[nationality1]++
+			}
+			if nationality2 != "" && nationality2 != nationality1 {
+				counts[nationality2]++
+				countNeighbour(nationality1, nationality2)
+				countNeighbour(nationality2, nationality1)
+			}
+		}
+
+		if err := rtfScanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	coverages := make([]NationCoverage, 0, len(counts))
+	for _, nation := range sortedKeys(counts) {
+		coverage := NationCoverage{Nation: nation, Players: counts[nation]}
+		coverage.Ethnic, _ = resolver.Nation(nation)
+		coverage.Weights, _ = resolver.Weights(nation)
+
+		if !coverage.Mapped() {
+			coverage.Suggestion, coverage.Region = suggestEthnic(resolver, nation, neighbours[nation])
+		}
+
+		coverages = append(coverages, coverage)
+	}
+
+	return coverages, nil
+}
+
+// suggestEthnic returns the group suggested for an unmapped nation and the
+// region it came from. The mapped nations of the region vote, the groups of
+// the players' other nationality break ties
+func suggestEthnic(resolver *Resolver, nation string, neighbours map[Ethnic]int) (Ethnic, string) {
+	region, others := nationRegion(nation)
+
+	votes := make(map[Ethnic]int)
+	for _, other := range others {
+		if ethnic, mapped := resolver.Nation(other); mapped {
+			votes[ethnic]++
+		}
+	}
+	if len(votes) == 0 {
+		return majorityEthnic(neighbours), ""
+	}
+
+	top := 0
+	for _, count := range votes {
+		top = max(top, count)
+	}
+	tied := make(map[Ethnic]int)
+	for ethnic, count := range votes {
+		if count == top {
+			tied[ethnic] = neighbours[ethnic]
+		}
+	}
+	return majorityEthnic(tied), region
+}
+
+// majorityEthnic returns the most counted group, ties going to the first
+// group in alphabetical order
+func majorityEthnic(counts map[Ethnic]int) Ethnic {
+	var majority Ethnic
+	for ethnic, count := range counts {
+		if majority == "" || count > counts[majority] || (count == counts[majority] && ethnic < majority) {
+			majority = ethnic
+		}
+	}
+	return majority
+}
+
+// MappingOverrideSnippet returns a [mapping_override] TOML block for the
+// unmapped nations, ready to paste into the config. Nations without a
+// suggestion are left commented out. It is empty when every nation is mapped
+func MappingOverrideSnippet(coverages []NationCoverage) string {
+	lines := []string{}
+	for _, coverage := range coverages {
+		switch {
+		case coverage.Mapped():
+			continue
+		case coverage.Suggestion == "":
+			lines = append(lines, fmt.Sprintf("# %s = \"\" # players: %d, no suggestion", coverage.Nation, coverage.Players))
+		case coverage.Region != "":
+			lines = append(lines, fmt.Sprintf("%s = %q # players: %d, from the nations of %s", coverage.Nation, coverage.Suggestion, coverage.Players, coverage.Region))
+		default:
+			lines = append(lines, fmt.Sprintf("%s = %q # players: %d, from their other nationality", coverage.Nation, coverage.Suggestion, coverage.Players))
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		// suggestions first, the commented out nations need a decision
+		return !strings.HasPrefix(lines[i], "#") && strings.HasPrefix(lines[j], "#")
+	})
+
+	return "[mapping_override]\n" + strings.Join(lines, "\n") + "\n"
+}
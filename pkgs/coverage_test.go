@@ -0,0 +1,80 @@
+package mapper
+
+import "testing"
+
+func TestCheckNationCoverage(t *testing.T) {
+	resolver := setupPlayers()
+	dir := t.TempDir()
+
+	rtfPath := writeRTF(t, dir, "players.rtf", "| 2000000001| XYZ       | FRA       | Aurelien                   | 1         | 5         | 0         | \n"+
+		"| 2000000002| XYZ       | GER       | Bastien                    | 1         | 5         | 0         | \n"+
+		"| 2000000003| XYZ       | COD       | Cedric                     | 1         | 5         | 3         | \n"+
+		"| 2000000004| QQQ       |           | Damien                     | 1         | 5         | 0         | \n")
+	// a player seen in a second file is only counted once
+	duplicatePath := writeRTF(t, dir, "duplicate.rtf", "| 2000000001| XYZ       | FRA       | Aurelien                   | 1         | 5         | 0         | \n")
+
+	coverages, err := CheckNationCoverage(resolver, []string{rtfPath, duplicatePath}, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	byNation := make(map[string]NationCoverage)
+	for _, coverage := range coverages {
+		byNation[coverage.Nation] = coverage
+	}
+
+	if len(coverages) != 5 {
+		t.Fatalf("expected 5 nations, got %d", len(coverages))
+	}
+	if xyz := byNation["XYZ"]; xyz.Mapped() || xyz.Players != 3 || xyz.Suggestion != CentralEuropean {
+		t.Fatalf("expected XYZ unmapped with 3 players and a Central European suggestion, got %+v", xyz)
+	}
+	if qqq := byNation["QQQ"]; qqq.Mapped() || qqq.Suggestion != "" {
+		t.Fatalf("expected QQQ unmapped without suggestion, got %+v", qqq)
+	}
+	if fra := byNation["FRA"]; fra.Ethnic != CentralEuropean || fra.Players != 1 {
+		t.Fatalf("expected FRA mapped to Central European with 1 player, got %+v", fra)
+	}
+
+	snippet := MappingOverrideSnippet(coverages)
+	expected := "[mapping_override]\nXYZ = \"Central European\" # players: 3, from their other nationality\n# QQQ = \"\" # players: 1, no suggestion\n"
+	if snippet != expected {
+		t.Fatalf("expected snippet %q, got %q", expected, snippet)
+	}
+	if MappingOverrideSnippet(nil) != "" {
+		t.Fatalf("expected no snippet without unmapped nations")
+	}
+}
+
+func TestCheckNationCoverage_Region(t *testing.T) {
+	resolver := NewResolver()
+	dir := t.TempDir()
+
+	// the Balkan nations outvote the other nationality
+	rtfPath := writeRTF(t, dir, "players.rtf", "| 2000000001| SCG       | GER       | Aurelien                   | 1         | 5         | 0         | \n")
+	coverages, err := CheckNationCoverage(resolver, []string{rtfPath}, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if scg := coverages[1]; scg.Nation != "SCG" || scg.Suggestion != YugoslavGreek || scg.Region != "Balkans" {
+		t.Fatalf("expected SCG suggested YugoGreek from the Balkans, got %+v", scg)
+	}
+
+	snippet := MappingOverrideSnippet(coverages)
+	expected := "[mapping_override]\nSCG = \"YugoGreek\" # players: 1, from the nations of Balkans\n"
+	if snippet != expected {
+		t.Fatalf("expected snippet %q, got %q", expected, snippet)
+	}
+
+	// a tie in the region goes to the other nationality
+	resolver = setupPlayers()
+	resolver.nations["AND"] = CentralEuropean
+	rtfPath = writeRTF(t, dir, "tie.rtf", "| 2000000002| GIB       | ESP       | Bastien                    | 1         | 5         | 0         | \n")
+	coverages, err = CheckNationCoverage(resolver, []string{rtfPath}, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if gib := coverages[1]; gib.Nation != "GIB" || gib.Suggestion != SpanishMediterranean || gib.Region != "Iberia" {
+		t.Fatalf("expected GIB suggested SpanMed from Iberia, got %+v", gib)
+	}
+}
@@ -0,0 +1,263 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultDuplicateThreshold is the largest hash distance at which two images
+// are considered the same photo
+const DefaultDuplicateThreshold = 4
+
+// ImageHash is a perceptual hash of an image, close images have hashes
+// differing in few bits whatever their size, format or name
+type ImageHash uint64
+
+// Distance returns the number of bits two hashes differ in, from 0 to 64
+func (hash ImageHash) Distance(other ImageHash) int {
+	return bits.OnesCount64(uint64(hash ^ other))
+}
+
+func (hash ImageHash) String() string {
+	return fmt.Sprintf("%016x", uint64(hash))
+}
+
+// PerceptualHash decodes an image and returns its difference hash
+func PerceptualHash(imagePath string) (ImageHash, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, fmt.Errorf("cannot decode image: %w", err)
+	}
+
+	return differenceHash(img), nil
+}
+
+// differenceHash shrinks an image to 9x8 grey cells and sets a bit for each
+// cell darker than its right neighbour
+func differenceHash(img image.Image) ImageHash {
+	const width, height = 9, 8
+	bounds := img.Bounds()
+
+	var cells [height][width]float64
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, y0+1)
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/width, x0+1)
+
+			// average luminance of the pixels the cell covers
+			sum, count := 0.0, 0
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					count++
+				}
+			}
+			cells[y][x] = sum / float64(count)
+		}
+	}
+
+	var hash ImageHash
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if cells[y][x] < cells[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// DuplicateGroup is a set of images showing the same photo. The first image
+// is the one kept, in file order
+type DuplicateGroup struct {
+	Images    []ImageInfo
+	Distances []int // distance of each image to the first one
+}
+
+// Duplicates returns the images of the group that are not kept
+func (group DuplicateGroup) Duplicates() []ImageInfo {
+	return group.Images[1:]
+}
+
+// FindDuplicates hashes the images of a pool report and groups those within
+// threshold bits of each other, across ethnic folders. Images that cannot be
+// decoded are returned as issues and left out of the groups
+func FindDuplicates(imageRootPath string, infos []ImageInfo, threshold int) ([]DuplicateGroup, []PoolIssue, error) {
+	return findDuplicates(infos, threshold, func(file string) (ImageHash, error) {
+		return PerceptualHash(filepath.Join(imageRootPath, filepath.FromSlash(file)))
+	})
+}
+
+// FindDuplicates groups the images of the pool like FindDuplicates, reusing
+// and saving the hashes of the pool index so that unchanged images are only
+// hashed once
+func (images *ImagePool) FindDuplicates(threshold int) ([]DuplicateGroup, []PoolIssue, error) {
+	groups, issues, err := findDuplicates(images.report.Images, threshold, images.index.hash)
+	images.saveIndex()
+	return groups, issues, err
+}
+
+func findDuplicates(infos []ImageInfo, threshold int, hashImage func(file string) (ImageHash, error)) ([]DuplicateGroup, []PoolIssue, error) {
+	if threshold < 0 || threshold > 64 {
+		return nil, nil, fmt.Errorf("duplicate threshold %d is not between 0 and 64", threshold)
+	}
+
+	infos = append([]ImageInfo{}, infos...)
+	sort.Slice(infos, func(i, j int) bool { return infos[i].File < infos[j].File })
+
+	hashed := make([]ImageInfo, 0, len(infos))
+	hashes := make([]ImageHash, 0, len(infos))
+	issues := []PoolIssue{}
+	for _, info := range infos {
+		hash, err := hashImage(info.File)
+		if err != nil {
+			issues = append(issues, PoolIssue{File: info.File, Reason: err.Error()})
+			continue
+		}
+		hashed = append(hashed, info)
+		hashes = append(hashes, hash)
+	}
+
+	// images close to any image of a group join the group
+	parents := make([]int, len(hashed))
+	for i := range parents {
+		parents[i] = i
+	}
+	root := func(i int) int {
+		for parents[i] != i {
+			parents[i] = parents[parents[i]]
+			i = parents[i]
+		}
+		return i
+	}
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			if hashes[i].Distance(hashes[j]) <= threshold {
+				// the lowest index stays the root so that groups keep file order
+				rootI, rootJ := root(i), root(j)
+				parents[max(rootI, rootJ)] = min(rootI, rootJ)
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := range hashed {
+		members[root(i)] = append(members[root(i)], i)
+	}
+
+	groups := []DuplicateGroup{}
+	for i := range hashed {
+		if len(members[i]) < 2 {
+			continue
+		}
+		group := DuplicateGroup{}
+		for _, member := range members[i] {
+			group.Images = append(group.Images, hashed[member])
+			group.Distances = append(group.Distances, hashes[i].Distance(hashes[member]))
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, issues, nil
+}
+
+// ExcludeDuplicates removes every image but the first of each group from the
+// pool and returns how many were removed
+func (images *ImagePool) ExcludeDuplicates(groups []DuplicateGroup) int {
+	excluded := make(map[FilePath]bool)
+	for _, group := range groups {
+		for _, duplicate := range group.Duplicates() {
+			excluded[duplicate.Path] = true
+		}
+	}
+
+	removed := 0
+	for ethnic, ethnicPool := range images.pool {
+		filteredPool := make([]PoolImage, 0, len(ethnicPool))
+		for _, image := range ethnicPool {
+			if excluded[image.Path] {
+				removed++
+				continue
+			}
+			filteredPool = append(filteredPool, image)
+		}
+		images.pool[ethnic] = filteredPool
+	}
+	return removed
+}
+
+// QuarantineDuplicates moves every image but the first of each group to the
+// quarantine folder, keeping their path relative to the image root. Images of
+// the additional roots keep their root's path without the leading "..", ex:
+// ../premium/African/face.png => premium/African/face.png. A quarantine folder
+// inside the image root or one of the roots is refused, as its images would
+// be read into the pool again
+func QuarantineDuplicates(imageRootPath string, roots []string, quarantinePath string, groups []DuplicateGroup) (int, error) {
+	quarantineAbs, err := filepath.Abs(quarantinePath)
+	if err != nil {
+		return 0, err
+	}
+	for _, root := range append([]string{"."}, roots...) {
+		rootAbs, err := filepath.Abs(filepath.Join(imageRootPath, filepath.FromSlash(root)))
+		if err != nil {
+			return 0, err
+		}
+		if insideFolder(quarantineAbs, rootAbs) {
+			return 0, fmt.Errorf("quarantine folder %s is inside the image root %s", quarantinePath, rootAbs)
+		}
+	}
+
+	moved := 0
+	moveErrors := []error{}
+
+	for _, group := range groups {
+		for _, duplicate := range group.Duplicates() {
+			source := filepath.Join(imageRootPath, filepath.FromSlash(duplicate.File))
+			target := filepath.Join(quarantinePath, filepath.FromSlash(quarantineFile(duplicate.File)))
+
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				moveErrors = append(moveErrors, err)
+				continue
+			}
+			if err := os.Rename(source, target); err != nil {
+				moveErrors = append(moveErrors, err)
+				continue
+			}
+			moved++
+		}
+	}
+
+	return moved, errors.Join(moveErrors...)
+}
+
+// quarantineFile returns where an image file goes in the quarantine folder,
+// its path without the leading ".." of an additional root
+func quarantineFile(file string) string {
+	for strings.HasPrefix(file, "../") {
+		file = strings.TrimPrefix(file, "../")
+	}
+	return file
+}
+
+// insideFolder reports whether a path is the folder or lies below it
+func insideFolder(path string, folder string) bool {
+	rel, err := filepath.Rel(folder, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,119 @@
+package mapper
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeGradient writes a PNG of the given size, getting lighter from left to
+// right or, when reversed, from right to left
+func writeGradient(t *testing.T, root, file string, size int, reversed bool) {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			shade := x * 255 / size
+			if reversed {
+				shade = 255 - shade
+			}
+			// a diagonal band so that rows differ
+			if (x+y)%(size/3) < size/12 {
+				shade = 255 - shade
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8(shade)})
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(file)), buffer.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	root := setupImageRoot(t)
+	writeGradient(t, root, "African/original.png", 48, false)
+	writeGradient(t, root, "SpanMed/copy.png", 96, false)
+	writeGradient(t, root, "African/other.png", 48, true)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, _, err := FindDuplicates(root, pool.Report().Images, 65); err == nil {
+		t.Fatalf("expected an error for a threshold above 64")
+	}
+
+	groups, issues, err := FindDuplicates(root, pool.Report().Images, DefaultDuplicateThreshold)
+	if err != nil || len(issues) > 0 {
+		t.Fatalf("expected no error, got %v %v", err, issues)
+	}
+	if len(groups) != 1 || len(groups[0].Images) != 2 {
+		t.Fatalf("expected a single group of two images, got %+v", groups)
+	}
+	if kept := groups[0].Images[0].Path; kept != "African/original" {
+		t.Fatalf("expected African/original to be kept, got %s", kept)
+	}
+
+	if removed := pool.ExcludeDuplicates(groups); removed != 1 || len(pool.pool[SpanishMediterranean]) != 0 {
+		t.Fatalf("expected SpanMed/copy to be excluded, got %d removed and %v", removed, pool.pool[SpanishMediterranean])
+	}
+
+	// a quarantine inside the image root would be read again
+	if _, err := QuarantineDuplicates(root, nil, filepath.Join(root, "quarantine"), groups); err == nil {
+		t.Fatal("expected an error for a quarantine inside the image root")
+	}
+
+	quarantine := t.TempDir()
+	if moved, err := QuarantineDuplicates(root, nil, quarantine, groups); err != nil || moved != 1 {
+		t.Fatalf("expected one image moved, got %d %v", moved, err)
+	}
+	if _, err := os.Stat(filepath.Join(quarantine, "SpanMed", "copy.png")); err != nil {
+		t.Fatalf("expected SpanMed/copy.png in the quarantine, got %v", err)
+	}
+}
+
+func TestQuarantineDuplicates_Roots(t *testing.T) {
+	root := setupImageRoot(t)
+	writeGradient(t, root, "African/other.png", 48, true)
+
+	premium := filepath.Join(filepath.Dir(root), "premium")
+	if err := os.MkdirAll(filepath.Join(premium, "African"), 0755); err != nil {
+		t.Fatalf("failed to create folder: %v", err)
+	}
+	writeGradient(t, premium, "African/original.png", 48, false)
+	writeGradient(t, premium, "African/copy.png", 96, false)
+
+	pool, err := NewImagePoolWithOptions(root, PoolOptions{Roots: []ImageRoot{{Path: premium}}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	groups, _, err := pool.FindDuplicates(DefaultDuplicateThreshold)
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("expected a single group, got %+v %v", groups, err)
+	}
+
+	if _, err := QuarantineDuplicates(root, pool.Roots(), filepath.Join(premium, "quarantine"), groups); err == nil {
+		t.Fatal("expected an error for a quarantine inside an additional root")
+	}
+	if _, err := os.Stat(filepath.Join(premium, "African", "original.png")); err != nil {
+		t.Fatalf("expected no image moved, got %v", err)
+	}
+
+	quarantine := t.TempDir()
+	if moved, err := QuarantineDuplicates(root, pool.Roots(), quarantine, groups); err != nil || moved != 1 {
+		t.Fatalf("expected one image moved, got %d %v", moved, err)
+	}
+	if _, err := os.Stat(filepath.Join(quarantine, "premium", "African", "original.png")); err != nil {
+		t.Fatalf("expected premium/African/original.png in the quarantine, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package mapper
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// EncodingAuto detects the encoding of a player export from its content
+const EncodingAuto = "auto"
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+var (
+	ansiCodePageRegex = regexp.MustCompile(`\\ansicpg(\d+)`)
+	rtfEscapeRegex    = regexp.MustCompile(`\\'([0-9a-fA-F]{2})`)
+)
+
+// codePages maps the code page numbers used by RTF's \ansicpg control word
+// to their encodings
+var codePages = map[int]encoding.Encoding{
+	437:   charmap.CodePage437,
+	850:   charmap.CodePage850,
+	852:   charmap.CodePage852,
+	855:   charmap.CodePage855,
+	858:   charmap.CodePage858,
+	860:   charmap.CodePage860,
+	862:   charmap.CodePage862,
+	863:   charmap.CodePage863,
+	865:   charmap.CodePage865,
+	866:   charmap.CodePage866,
+	874:   charmap.Windows874,
+	1250:  charmap.Windows1250,
+	1251:  charmap.Windows1251,
+	1252:  charmap.Windows1252,
+	1253:  charmap.Windows1253,
+	1254:  charmap.Windows1254,
+	1255:  charmap.Windows1255,
+	1256:  charmap.Windows1256,
+	1257:  charmap.Windows1257,
+	1258:  charmap.Windows1258,
+	10000: charmap.Macintosh,
+}
+
+// lookupEncoding resolves an encoding name from the config, e.g. "utf-16le",
+// "windows-1252", "latin1" or a bare code page number such as "1252"
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	if codePage, err := strconv.Atoi(strings.TrimPrefix(name, "cp")); err == nil {
+		if enc, ok := codePages[codePage]; ok {
+			return enc, nil
+		}
+		return nil, fmt.Errorf("unsupported code page: %d", codePage)
+	}
+
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	return enc, nil
+}
+
+// hasNonASCII reports whether data holds bytes outside of ASCII
+func hasNonASCII(data []byte) bool {
+	for _, b := range data {
+		if b >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+// rtfCodePage returns the encoding of the RTF \ansicpg control word
+func rtfCodePage(data []byte) (encoding.Encoding, int, bool) {
+	matches := ansiCodePageRegex.FindSubmatch(data)
+	if matches == nil {
+		return nil, 0, false
+	}
+	codePage, _ := strconv.Atoi(string(matches[1]))
+	enc, ok := codePages[codePage]
+	return enc, codePage, ok
+}
+
+// detectEncoding guesses the encoding of a player export. Byte order marks
+// win, followed by UTF-16 without a BOM, UTF-8 when non-ASCII text is valid
+// UTF-8, the RTF \ansicpg code page and finally Windows-1252
+func detectEncoding(data []byte) (encoding.Encoding, string) {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return unicode.UTF8BOM, "UTF-8 (BOM)"
+	case bytes.HasPrefix(data, utf16LEBOM):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), "UTF-16LE (BOM)"
+	case bytes.HasPrefix(data, utf16BEBOM):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), "UTF-16BE (BOM)"
+	}
+
+	// text exported as UTF-16 without a BOM has a zero byte next to every
+	// ASCII character, on the odd side for little endian
+	sample := data
+	if len(sample) > 1024 {
+		sample = sample[:1024]
+	}
+	evenZeros, oddZeros := 0, 0
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenZeros++
+		} else {
+			oddZeros++
+		}
+	}
+	if half := len(sample) / 2; half > 0 {
+		if oddZeros > half*3/4 && evenZeros == 0 {
+			return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), "UTF-16LE"
+		}
+		if evenZeros > half*3/4 && oddZeros == 0 {
+			return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), "UTF-16BE"
+		}
+	}
+
+	// non-ASCII text that is valid UTF-8 is hardly anything else, whatever
+	// code page the RTF header claims
+	if utf8.Valid(data) && hasNonASCII(data) {
+		return unicode.UTF8, "UTF-8"
+	}
+
+	if enc, codePage, ok := rtfCodePage(sample); ok {
+		return enc, fmt.Sprintf("code page %d", codePage)
+	}
+
+	if utf8.Valid(data) {
+		return unicode.UTF8, "UTF-8"
+	}
+
+	return charmap.Windows1252, "Windows-1252"
+}
+
+// DecodePlayerFile transcodes the raw content of a player export to UTF-8.
+// An empty name or EncodingAuto detects the encoding, anything else is taken
+// as an explicit override
+func DecodePlayerFile(data []byte, encodingName string) ([]byte, error) {
+	var enc encoding.Encoding
+
+	if encodingName == "" || strings.EqualFold(encodingName, EncodingAuto) {
+		enc, encodingName = detectEncoding(data)
+	} else {
+		var err error
+		enc, err = lookupEncoding(encodingName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode player file as %s: %w", encodingName, err)
+	}
+
+	// explicit overrides such as utf-8 or utf-16le pass a byte order mark through
+	decoded = bytes.TrimPrefix(decoded, utf8BOM)
+	return decodeRTFEscapes(decoded), nil
+}
+
+// decodeRTFEscapes replaces the \'hh escapes of an RTF document, such as
+// \'e9 for "é", with the characters of its \ansicpg code page, Windows-1252
+// when none is given. Text that is not RTF is returned as is
+func decodeRTFEscapes(data []byte) []byte {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte(`{\rtf`)) {
+		return data
+	}
+
+	enc, _, ok := rtfCodePage(data)
+	if !ok {
+		enc = charmap.Windows1252
+	}
+	decoder := enc.NewDecoder()
+
+	return rtfEscapeRegex.ReplaceAllFunc(data, func(escape []byte) []byte {
+		value, _ := strconv.ParseUint(string(escape[2:]), 16, 8)
+		decoded, err := decoder.Bytes([]byte{byte(value)})
+		if err != nil {
+			return escape
+		}
+		return decoded
+	})
+}
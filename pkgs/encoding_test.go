@@ -0,0 +1,108 @@
+package mapper
+
+import (
+	"bytes"
+	"testing"
+)
+
+const encodingSample = "| 2000134233| ESP       |           | Joaquín Peñalver           | 1         | 9         | 0         | \n"
+
+func TestDecodePlayerFile_UTF16LEWithBOM(t *testing.T) {
+	encoded := []byte{0xFF, 0xFE}
+	for _, r := range encodingSample {
+		encoded = append(encoded, byte(r), byte(r>>8))
+	}
+
+	decoded, err := DecodePlayerFile(encoded, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(decoded) != encodingSample {
+		t.Fatalf("expected %q, got %q", encodingSample, decoded)
+	}
+}
+
+func TestDecodePlayerFile_UTF16LEWithoutBOM(t *testing.T) {
+	encoded := []byte{}
+	for _, r := range encodingSample {
+		encoded = append(encoded, byte(r), byte(r>>8))
+	}
+
+	if _, name := detectEncoding(encoded); name != "UTF-16LE" {
+		t.Fatalf("expected UTF-16LE, got %s", name)
+	}
+	decoded, err := DecodePlayerFile(encoded, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(decoded) != encodingSample {
+		t.Fatalf("expected %q, got %q", encodingSample, decoded)
+	}
+}
+
+func TestDetectEncoding_Windows1252NotUTF16(t *testing.T) {
+	// a padded line ending leaves a few zero bytes, far from one every other byte
+	encoded := bytes.ReplaceAll([]byte(encodingSample), []byte("í"), []byte{0xED})
+	encoded = bytes.ReplaceAll(encoded, []byte("ñ"), []byte{0xF1})
+	encoded = append(bytes.Repeat(encoded, 4), 0, 0, 0)
+
+	if _, name := detectEncoding(encoded); name != "Windows-1252" {
+		t.Fatalf("expected Windows-1252, got %s", name)
+	}
+}
+
+func TestDecodePlayerFile_Windows1252(t *testing.T) {
+	encoded := bytes.ReplaceAll([]byte(encodingSample), []byte("í"), []byte{0xED})
+	encoded = bytes.ReplaceAll(encoded, []byte("ñ"), []byte{0xF1})
+
+	decoded, err := DecodePlayerFile(encoded, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(decoded) != encodingSample {
+		t.Fatalf("expected %q, got %q", encodingSample, decoded)
+	}
+}
+
+func TestDecodePlayerFile_ANSICodePage(t *testing.T) {
+	// 0xE8 is "č" in Windows-1250 but "è" in Windows-1252
+	encoded := []byte("{\\rtf1\\ansi\\ansicpg1250 Lu\xE8i\xE6}")
+
+	decoded, err := DecodePlayerFile(encoded, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.Contains(decoded, []byte("Lučić")) {
+		t.Fatalf("expected Windows-1250 decoding, got %q", decoded)
+	}
+}
+
+func TestDecodePlayerFile_UnknownOverride(t *testing.T) {
+	if _, err := DecodePlayerFile([]byte(encodingSample), "not-an-encoding"); err == nil {
+		t.Fatal("expected an error but got none")
+	}
+}
+
+func TestDecodePlayerFile_UTF8WithCodePageHeader(t *testing.T) {
+	encoded := []byte("{\\rtf1\\ansi\\ansicpg1252 Joaquín Peñalver}")
+
+	decoded, err := DecodePlayerFile(encoded, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.Contains(decoded, []byte("Joaquín Peñalver")) {
+		t.Fatalf("expected UTF-8 decoding, got %q", decoded)
+	}
+}
+
+func TestDecodePlayerFile_RTFEscapes(t *testing.T) {
+	encoded := []byte("{\\rtf1\\ansi\\ansicpg1250 Lu\\'e8i\\'e6 Pe\\'F1a}")
+
+	decoded, err := DecodePlayerFile(encoded, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.Contains(decoded, []byte("Lučić Peńa")) {
+		t.Fatalf("expected the escapes decoded as Windows-1250, got %q", decoded)
+	}
+}
@@ -0,0 +1,295 @@
+package mapper
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Explanation traces how a player is given an ethnic and an image
+type Explanation struct {
+	Player    Player   // player as read from the export, without Ethnic when EthnicErr is set
+	Row       []string // columns of the player's RTF row
+	Trace     EthnicTrace
+	Rules     []EthnicRule // rule table the trace refers to
+	EthnicErr error        // why no ethnic could be decided
+	Pin       *PlayerPin   // pin of the player, nil when not pinned
+
+	Existing  FilePath // image of the player in the current mapping
+	Preserved bool     // the existing image is kept
+	Replaced  string   // why the existing image is not kept
+
+	Pools    []PoolTrace // pools tried in order, the first one is the player's ethnic
+	Image    FilePath    // an image a run could give the player
+	Served   Ethnic      // ethnic whose pool the image comes from
+	ImageErr error       // why no image could be picked
+}
+
+// FindPlayerRow returns the columns of a player's row and the file it was
+// found in. Files are searched in order, as GetPlayersFromFiles keeps the
+// first row seen
+func FindPlayerRow(rtfPaths []string, encodingName string, id PlayerID) ([]string, string, error) {
+	var row []string
+	var source string
+	err := scanPlayerRows(rtfPaths, encodingName, func(rowID PlayerID, rtfData []string, rtfPath string) bool {
+		if rowID == id {
+			row, source = rtfData, rtfPath
+		}
+		return row == nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if row == nil {
+		return nil, "", fmt.Errorf("player %s not found in the player files", id)
+	}
+	return row, source, nil
+}
+
+// runPlayers returns the players of the player files by ID, those a run of
+// the files gives an image to
+func runPlayers(rtfPaths []string, encodingName string) ([]Player, error) {
+	players := []Player{}
+	err := scanPlayerRows(rtfPaths, encodingName, func(id PlayerID, _ []string, _ string) bool {
+		players = append(players, Player{ID: id})
+		return true
+	})
+	return players, err
+}
+
+// scanPlayerRows calls visit with every player row of the player files, in
+// order, until it returns false
+func scanPlayerRows(rtfPaths []string, encodingName string, visit func(id PlayerID, rtfData []string, rtfPath string) bool) error {
+	for _, rtfPath := range rtfPaths {
+		rtfBytes, err := os.ReadFile(rtfPath)
+		if err != nil {
+			return err
+		}
+
+		rtfBytes, err = DecodePlayerFile(rtfBytes, encodingName)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rtfPath, err)
+		}
+
+		rtfScanner := bufio.NewScanner(bytes.NewReader(rtfBytes))
+		for rtfScanner.Scan() {
+			id, rtfData, err := parsePlayerRow(rtfScanner.Text())
+			if err != nil {
+				return fmt.Errorf("%s: %w", rtfPath, err)
+			}
+			if rtfData != nil && !visit(id, rtfData, rtfPath) {
+				return nil
+			}
+		}
+
+		if err := rtfScanner.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExplainPlayer traces the ethnic and image a run would give a player. The
+// mapping and the image pool are optional, without them the trace stops at
+// the ethnic. The pool is drawn from through a copy prepared as at the start
+// of a run of the player files: pinned images and, without duplicates, the
+// images the mapping keeps are taken, usage counts and caps apply. No image
+// is removed from the pool itself
+func ExplainPlayer(resolver *Resolver, rtfPaths []string, encodingName string, id PlayerID, mapping *Mapping, images *ImagePool, options AssignOptions) (Explanation, error) {
+	rtfData, source, err := FindPlayerRow(rtfPaths, encodingName, id)
+	if err != nil {
+		return Explanation{}, err
+	}
+
+	ethnicValue, err := strconv.Atoi(rtfData[7])
+	if err != nil {
+		return Explanation{}, err
+	}
+	skinTone, _ := strconv.Atoi(rtfData[6])
+
+	explanation := Explanation{
+		Player: Player{
+			ID:                id,
+			Nationality:       rtfData[2],
+			SecondNationality: rtfData[3],
+			EthnicValue:       ethnicValue,
+			SkinTone:          skinTone,
+			Age:               playerAge(rtfData),
+			Source:            source,
+		},
+		Row:   rtfData,
+		Rules: resolver.rules,
+	}
+
+	explanation.Player.Ethnic, explanation.Trace, explanation.EthnicErr = traceEthnic(resolver, rtfData[2], rtfData[3], ethnicValue)
+	explanation.Player.Warning = explanation.Trace.Warning
+
+	if pin, isPinned := options.Pins[id]; isPinned {
+		explanation.Pin = &pin
+		if pin.Image != "" {
+			explanation.Image = options.mappedPath(pin.Image)
+			return explanation, nil
+		}
+		explanation.Player.Ethnic = pin.Ethnic
+		explanation.EthnicErr = nil
+	}
+
+	if explanation.EthnicErr != nil {
+		return explanation, nil
+	}
+
+	pinned := pinnedImages(options.Pins)
+	mappedPins := make(map[FilePath]PlayerID)
+	for image, owner := range pinned {
+		mappedPins[options.mappedPath(image)] = owner
+	}
+
+	if mapping != nil {
+		explanation.Existing, _ = mapping.Image(id)
+		explanation.Preserved = options.Preserve && keepsImage(mapping, explanation.Player, mappedPins, options)
+
+		if owner, isPinned := mappedPins[explanation.Existing]; explanation.Existing != "" && !explanation.Preserved {
+			switch {
+			case !options.Preserve:
+				explanation.Replaced = "preserve is off"
+			case isPinned && owner != id:
+				explanation.Replaced = fmt.Sprintf("the image is pinned to player %s", owner)
+			default:
+				explanation.Replaced = "the image is not of the pinned ethnic"
+			}
+		}
+	}
+
+	if images != nil {
+		images = images.clone()
+		images.reserveImages(pinned)
+	}
+
+	if images != nil && mapping != nil {
+		if !options.AllowDuplicate {
+			players, err := runPlayers(rtfPaths, encodingName)
+			if err != nil {
+				return explanation, err
+			}
+			images.ExcludeImages(keptImages(mapping, players, mappedPins, options))
+		}
+
+		// a replaced image is one use less, as in a run
+		if options.tracksUsage() {
+			images.trackUsage(mapping, options)
+			if image, inPool := options.poolPath(explanation.Existing); inPool && explanation.Existing != "" && !explanation.Preserved {
+				images.releaseImage(image)
+			}
+		}
+	}
+
+	if images != nil && !explanation.Preserved {
+		explanation.Pools = images.TracePools(explanation.Player)
+
+		var image FilePath
+		image, explanation.Served, explanation.ImageErr = images.GetImagePath(explanation.Player, false)
+		if explanation.ImageErr == nil {
+			explanation.Image = options.mappedPath(image)
+		}
+	}
+
+	return explanation, nil
+}
+
+// String describes every step of the explanation, one per line
+func (e Explanation) String() string {
+	lines := []string{
+		fmt.Sprintf("Player %s (%s)", e.Player.ID, e.Player.Source),
+		fmt.Sprintf("  RTF row: %s", strings.Trim(strings.Join(e.Row, " | "), " |")),
+	}
+
+	describeNation := func(label, nation string, ethnic Ethnic) string {
+		switch {
+		case nation == "":
+			return fmt.Sprintf("  %s: none", label)
+		case ethnic == "":
+			return fmt.Sprintf("  %s: %s → unknown", label, nation)
+		default:
+			return fmt.Sprintf("  %s: %s → %s", label, nation, ethnic)
+		}
+	}
+	lines = append(lines,
+		describeNation("Nationality", e.Player.Nationality, e.Trace.Ethnic1),
+		describeNation("Second nationality", e.Player.SecondNationality, e.Trace.Ethnic2),
+		fmt.Sprintf("  Ethnic value: %d, skin tone: %d, age: %d", e.Player.EthnicValue, e.Player.SkinTone, e.Player.Age),
+	)
+
+	if e.Trace.Warning != "" {
+		lines = append(lines, fmt.Sprintf("  Warning: %s", e.Trace.Warning))
+	}
+	if e.Trace.RuleIndex >= 0 {
+		lines = append(lines, fmt.Sprintf("  Rule: %d %s → %s", e.Trace.RuleIndex+1, e.Rules[e.Trace.RuleIndex], e.Trace.RuleResult))
+	}
+
+	for _, nation := range e.Trace.Overridden {
+		lines = append(lines, fmt.Sprintf("  Override: %s mapped by the mapping overrides", nation))
+	}
+	switch {
+	case e.Trace.OverrideKey == "" && len(e.Trace.Overridden) == 0:
+		lines = append(lines, "  Override: none")
+	case e.Trace.OverrideKey == "":
+	case e.Trace.RuleIndex < 0:
+		lines = append(lines, fmt.Sprintf("  Override: %s decides on its own (%s)", e.Trace.OverrideKey, e.Trace.Weights))
+	default:
+		lines = append(lines, fmt.Sprintf("  Override: drawn from the %s weights (%s)", e.Trace.OverrideKey, e.Trace.Weights))
+	}
+
+	if e.Pin != nil && e.Pin.Image != "" {
+		return strings.Join(append(lines, fmt.Sprintf("  Image: %s, pinned by the player overrides", e.Image)), "\n")
+	}
+
+	if e.EthnicErr != nil {
+		return strings.Join(append(lines, fmt.Sprintf("  Ethnic: error: %v", e.EthnicErr)), "\n")
+	}
+	if e.Pin != nil {
+		lines = append(lines, fmt.Sprintf("  Ethnic: %s, pinned by the player overrides", e.Player.Ethnic))
+	} else {
+		lines = append(lines, fmt.Sprintf("  Ethnic: %s", e.Player.Ethnic))
+	}
+
+	if e.Existing != "" {
+		if e.Preserved {
+			return strings.Join(append(lines, fmt.Sprintf("  Image: %s, preserved from the existing mapping", e.Existing)), "\n")
+		}
+		lines = append(lines, fmt.Sprintf("  Existing image: %s, replaced as %s", e.Existing, e.Replaced))
+	}
+
+	for i, pool := range e.Pools {
+		label := "Pool"
+		if i > 0 {
+			label = "Fallback"
+		}
+
+		bucket := "whole pool"
+		if pool.Tone.IsSet() {
+			bucket = fmt.Sprintf("tone bucket %s", pool.Tone)
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %s, %d images, %d candidates from the %s", label, pool.Ethnic, pool.Images, pool.Candidates, bucket))
+		if pool.Capped > 0 {
+			lines = append(lines, fmt.Sprintf("    %d images left out at the usage cap", pool.Capped))
+		}
+		if pool.Aged > 0 {
+			lines = append(lines, fmt.Sprintf("    %d candidates of an age band holding age %d", pool.Aged, e.Player.Age))
+		}
+		if len(pool.Rules) > 0 {
+			lines = append(lines, fmt.Sprintf("    %d candidates after the tag rules %s", pool.Tagged, strings.Join(pool.Rules, ", ")))
+		}
+	}
+
+	switch {
+	case e.ImageErr != nil:
+		lines = append(lines, fmt.Sprintf("  Image: error: %v", e.ImageErr))
+	case e.Image != "":
+		lines = append(lines, fmt.Sprintf("  Image: %s from the %s pool, drawn at random among the candidates", e.Image, e.Served))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,115 @@
+package mapper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplainPlayer_TracesRuleAndFallback(t *testing.T) {
+	resolver := setupPlayers()
+
+	rtfPath := writeRTF(t, t.TempDir(), "players.rtf", "| 2000133376| FRA       | COD       | Isaac Ngoy                 | 1         | 5         | 3         | \n")
+	root := setupImageRoot(t, "SpanMed/spanish.png")
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := pool.SetFallbacks(map[string][]string{"African": {"SpanMed"}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	explanation, err := ExplainPlayer(resolver, []string{rtfPath}, EncodingAuto, "2000133376", nil, pool, AssignOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if explanation.Player.Ethnic != African || explanation.Trace.Ethnic2 != African {
+		t.Fatalf("expected African from the second nationality, got %+v", explanation)
+	}
+	if rule := explanation.Rules[explanation.Trace.RuleIndex]; rule.Name != "black and mixed" {
+		t.Fatalf("expected the black and mixed rule, got %s", rule)
+	}
+	if explanation.Served != SpanishMediterranean || explanation.Image != "SpanMed/spanish" {
+		t.Fatalf("expected the SpanMed fallback to serve the image, got %s from %s", explanation.Image, explanation.Served)
+	}
+	if !strings.Contains(explanation.String(), "Fallback: SpanMed") {
+		t.Fatalf("expected the fallback in the explanation, got %s", explanation)
+	}
+}
+
+func TestExplainPlayer_NotFound(t *testing.T) {
+	rtfPath := writeRTF(t, t.TempDir(), "players.rtf", "")
+
+	_, err := ExplainPlayer(NewResolver(), []string{rtfPath}, EncodingAuto, "2000133376", nil, nil, AssignOptions{})
+	if err == nil || !strings.Contains(err.Error(), "player 2000133376 not found") {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+}
+
+func TestExplainPlayer_OverrideAndPins(t *testing.T) {
+	resolver := setupPlayers()
+	if err := OverrideNationEthnicMapping(resolver, map[string]string{"FRA": string(SpanishMediterranean)}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	rtfPath := writeRTF(t, t.TempDir(), "players.rtf", "| 2000133376| FRA       |           | Jean Dupont                | 1         | 5         | 1         | \n")
+	root := setupImageRoot(t, "SpanMed/pinned.png", "SpanMed/free.png")
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	options := AssignOptions{Pins: map[PlayerID]PlayerPin{"2000133999": {Image: "SpanMed/pinned"}}}
+
+	explanation, err := ExplainPlayer(resolver, []string{rtfPath}, EncodingAuto, "2000133376", nil, pool, options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !strings.Contains(explanation.String(), "Override: FRA mapped by the mapping overrides") {
+		t.Fatalf("expected the override of FRA in the explanation, got %s", explanation)
+	}
+	if explanation.Image != "SpanMed/free" {
+		t.Fatalf("expected the image that is not pinned, got %s", explanation.Image)
+	}
+	if len(pool.pool[SpanishMediterranean]) != 2 {
+		t.Fatalf("expected the pinned image to stay in the pool, got %v", pool.pool[SpanishMediterranean])
+	}
+}
+
+func TestExplainPlayer_PreparesPoolLikeRun(t *testing.T) {
+	resolver := setupPlayers()
+	rtfPath := writeRTF(t, t.TempDir(), "players.rtf", "| 2000133376| FRA       |           | Jean Dupont                | 1         | 5         | 0         | \n")
+	root := setupImageRoot(t, "Central European/a.png", "Central European/b.png")
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// a player outside of the player files keeps a
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{"0": "Central European/a"}}
+
+	for _, options := range []AssignOptions{{}, {AllowDuplicate: true, MaxUses: 1}} {
+		for i := 0; i < 10; i++ {
+			explanation, err := ExplainPlayer(resolver, []string{rtfPath}, EncodingAuto, "2000133376", mapping, pool, options)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if explanation.Image != "Central European/b" {
+				t.Fatalf("expected the image the mapping does not give out with %+v, got %s", options, explanation)
+			}
+		}
+	}
+
+	explanation, err := ExplainPlayer(resolver, []string{rtfPath}, EncodingAuto, "2000133376", mapping, pool, AssignOptions{AllowDuplicate: true, MaxUses: 1})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(explanation.String(), "1 images left out at the usage cap") {
+		t.Fatalf("expected the capped image in the explanation, got %s", explanation)
+	}
+	if len(pool.pool[CentralEuropean]) != 2 || pool.usage != nil {
+		t.Fatalf("expected the pool to be left as it was, got %v %v", pool.pool[CentralEuropean], pool.usage)
+	}
+}
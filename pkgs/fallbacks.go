@@ -0,0 +1,66 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// SetFallbacks sets the groups tried in order when the pool of an ethnic is
+// missing or exhausted, ex: Italmed => [SpanMed, Central European]
+func (images *ImagePool) SetFallbacks(fallbacks map[string][]string) error {
+	fallbackErrors := []error{}
+	chains := make(map[Ethnic][]Ethnic)
+
+	ethnics := make([]string, 0, len(fallbacks))
+	for ethnic := range fallbacks {
+		ethnics = append(ethnics, ethnic)
+	}
+	sort.Strings(ethnics)
+
+	for _, ethnic := range ethnics {
+		if !images.groups.IsValid(ethnic) {
+			fallbackErrors = append(fallbackErrors, fmt.Errorf(`fallbacks given for "%s" which is not valid ethnic`, ethnic))
+			continue
+		}
+
+		chain := make([]Ethnic, 0, len(fallbacks[ethnic]))
+		for _, fallback := range fallbacks[ethnic] {
+			switch {
+			case !images.groups.IsValid(fallback):
+				fallbackErrors = append(fallbackErrors, fmt.Errorf(`fallbacks of "%s": "%s" is not valid ethnic`, ethnic, fallback))
+			case fallback == ethnic:
+				fallbackErrors = append(fallbackErrors, fmt.Errorf(`fallbacks of "%s": a group cannot fall back to itself`, ethnic))
+			default:
+				chain = append(chain, Ethnic(fallback))
+			}
+		}
+		chains[Ethnic(ethnic)] = chain
+	}
+
+	if len(fallbackErrors) > 0 {
+		return errors.Join(fallbackErrors...)
+	}
+
+	images.fallbacks = chains
+	return nil
+}
+
+// fallbackChain returns the ethnics to draw from for a player of the given
+// ethnic: the ethnic itself, its fallbacks and then their own fallbacks
+func (images *ImagePool) fallbackChain(ethnic Ethnic) []Ethnic {
+	chain := []Ethnic{ethnic}
+	seen := map[Ethnic]bool{ethnic: true}
+
+	for i := 0; i < len(chain); i++ {
+		for _, fallback := range images.fallbacks[chain[i]] {
+			if seen[fallback] {
+				continue
+			}
+			seen[fallback] = true
+			chain = append(chain, fallback)
+		}
+	}
+
+	return chain
+}
@@ -0,0 +1,189 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// EthnicGroup is a user-defined ethnic group on top of the built-in ones, ex:
+// "West African" with the parent "African"
+type EthnicGroup struct {
+	Folder string `toml:"folder,omitempty"` // folder in the image root, defaults to the group name
+	Parent Ethnic `toml:"parent,omitempty"` // group the custom group is a kind of
+}
+
+// EthnicGroups are the ethnic groups of a run: the built-in ones and the
+// user-defined groups of its config. Every run builds its own, so that runs
+// and profiles never share groups. A nil *EthnicGroups holds the built-in
+// groups only
+type EthnicGroups struct {
+	custom map[Ethnic]EthnicGroup
+}
+
+// NewEthnicGroups validates the user-defined ethnic groups of the config.
+// The groups are validated as a whole
+func NewEthnicGroups(groups map[string]EthnicGroup) (*EthnicGroups, error) {
+	builtins := mapset.NewSet[Ethnic](Ethnicities[:]...)
+	groupErrors := []error{}
+
+	customs := make(map[Ethnic]EthnicGroup)
+	folders := make(map[string]Ethnic)
+	for _, ethnic := range Ethnicities {
+		folders[string(ethnic)] = ethnic
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		group := groups[name]
+		ethnic := Ethnic(name)
+
+		if name == "" {
+			groupErrors = append(groupErrors, errors.New("ethnic group name is empty"))
+			continue
+		}
+		if builtins.Contains(ethnic) {
+			groupErrors = append(groupErrors, fmt.Errorf(`ethnic group "%s" is already built in`, name))
+			continue
+		}
+
+		if group.Folder == "" {
+			group.Folder = name
+		}
+		if owner, taken := folders[group.Folder]; taken {
+			groupErrors = append(groupErrors, fmt.Errorf(`ethnic group "%s" uses the folder "%s" of "%s"`, name, group.Folder, owner))
+			continue
+		}
+		folders[group.Folder] = ethnic
+
+		customs[ethnic] = group
+	}
+
+	for _, name := range names {
+		ethnic := Ethnic(name)
+		group, ok := customs[ethnic]
+		if !ok || group.Parent == "" {
+			continue
+		}
+
+		if _, isCustom := customs[group.Parent]; !isCustom && !builtins.Contains(group.Parent) {
+			groupErrors = append(groupErrors, fmt.Errorf(`ethnic group "%s" has unknown parent "%s"`, name, group.Parent))
+			continue
+		}
+
+		// walk up the parents to catch cycles such as A → B → A
+		seen := mapset.NewSet(ethnic)
+		for parent := group.Parent; parent != ""; parent = customs[parent].Parent {
+			if !seen.Add(parent) {
+				groupErrors = append(groupErrors, fmt.Errorf(`ethnic group "%s" has a cyclic parent chain`, name))
+				break
+			}
+		}
+	}
+
+	if len(groupErrors) > 0 {
+		return nil, errors.Join(groupErrors...)
+	}
+
+	return &EthnicGroups{custom: customs}, nil
+}
+
+// IsValid reports whether ethnic is a built-in or user-defined group
+func (groups *EthnicGroups) IsValid(ethnic string) bool {
+	if slices.Contains(Ethnicities[:], Ethnic(ethnic)) {
+		return true
+	}
+	_, isCustom := groups.group(Ethnic(ethnic))
+	return isCustom
+}
+
+// group returns a user-defined group
+func (groups *EthnicGroups) group(ethnic Ethnic) (EthnicGroup, bool) {
+	if groups == nil {
+		return EthnicGroup{}, false
+	}
+	group, ok := groups.custom[ethnic]
+	return group, ok
+}
+
+// All returns the built-in ethnics followed by the user-defined ones in
+// alphabetical order
+func (groups *EthnicGroups) All() []Ethnic {
+	ethnics := append([]Ethnic{}, Ethnicities[:]...)
+	if groups == nil {
+		return ethnics
+	}
+
+	customs := make([]Ethnic, 0, len(groups.custom))
+	for ethnic := range groups.custom {
+		customs = append(customs, ethnic)
+	}
+	sort.Slice(customs, func(i, j int) bool { return customs[i] < customs[j] })
+
+	return append(ethnics, customs...)
+}
+
+// Set returns the built-in and user-defined groups
+func (groups *EthnicGroups) Set() mapset.Set[Ethnic] {
+	return mapset.NewSet(groups.All()...)
+}
+
+// Folder returns the folder holding the images of an ethnic
+func (groups *EthnicGroups) Folder(ethnic Ethnic) string {
+	if group, ok := groups.group(ethnic); ok {
+		return group.Folder
+	}
+	return string(ethnic)
+}
+
+// ImageEthnic returns the ethnic whose folder holds an image given relative
+// to the image root, the deepest folder winning when folders are nested
+func (groups *EthnicGroups) ImageEthnic(image FilePath) (Ethnic, bool) {
+	imagePath := strings.ReplaceAll(string(image), "\\", "/")
+
+	var found Ethnic
+	for _, ethnic := range groups.All() {
+		folder := groups.Folder(ethnic)
+		if strings.HasPrefix(imagePath, folder+"/") && len(folder) > len(groups.Folder(found)) {
+			found = ethnic
+		}
+	}
+	return found, found != ""
+}
+
+// Parent returns the parent of a user-defined ethnic group
+func (groups *EthnicGroups) Parent(ethnic Ethnic) (Ethnic, bool) {
+	group, ok := groups.group(ethnic)
+	if !ok || group.Parent == "" {
+		return "", false
+	}
+	return group.Parent, true
+}
+
+// isKindOf reports whether ethnic is target or one of its descendants
+func (groups *EthnicGroups) isKindOf(ethnic, target Ethnic) bool {
+	for depth := 0; ethnic != "" && depth <= groups.count(); depth++ {
+		if ethnic == target {
+			return true
+		}
+		ethnic, _ = groups.Parent(ethnic)
+	}
+	return false
+}
+
+// count returns the number of user-defined groups
+func (groups *EthnicGroups) count() int {
+	if groups == nil {
+		return 0
+	}
+	return len(groups.custom)
+}
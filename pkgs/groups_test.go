@@ -0,0 +1,162 @@
+package mapper
+
+import (
+	"strings"
+	"testing"
+)
+
+func setupGroups(t *testing.T, custom map[string]EthnicGroup) *EthnicGroups {
+	t.Helper()
+	groups, err := NewEthnicGroups(custom)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return groups
+}
+
+func TestNewEthnicGroups_Registers(t *testing.T) {
+	groups := setupGroups(t, map[string]EthnicGroup{
+		"West African":     {Parent: African},
+		"Pacific Islander": {Folder: "Pacific"},
+	})
+
+	if !groups.IsValid("West African") || !groups.IsValid("Pacific Islander") {
+		t.Fatal("expected custom groups to be valid ethnics")
+	}
+	if groups.Folder("Pacific Islander") != "Pacific" || groups.Folder("West African") != "West African" {
+		t.Fatal("expected custom group folders to be set")
+	}
+
+	ethnics := groups.All()
+	if len(ethnics) != len(Ethnicities)+2 || ethnics[len(ethnics)-1] != "West African" {
+		t.Fatalf("expected built-in ethnics followed by sorted custom groups, got %v", ethnics)
+	}
+}
+
+func TestNewEthnicGroups_Invalid(t *testing.T) {
+	_, err := NewEthnicGroups(map[string]EthnicGroup{
+		"African": {},
+		"A":       {Parent: "B"},
+		"B":       {Parent: "A"},
+		"C":       {Parent: "Martian"},
+		"D":       {Folder: "Asian"},
+	})
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+
+	for _, expectedErrorMsg := range []string{
+		`ethnic group "African" is already built in`,
+		`ethnic group "A" has a cyclic parent chain`,
+		`ethnic group "C" has unknown parent "Martian"`,
+		`ethnic group "D" uses the folder "Asian" of "Asian"`,
+	} {
+		if !strings.Contains(err.Error(), expectedErrorMsg) {
+			t.Fatalf("expected error message to contain %q, got %q", expectedErrorMsg, err.Error())
+		}
+	}
+
+	var builtins *EthnicGroups
+	if builtins.IsValid("A") || !builtins.IsValid("African") {
+		t.Fatal("expected only the built-in groups without user-defined ones")
+	}
+}
+
+func TestEvaluateEthnicRules_CustomGroupSpecialisesParent(t *testing.T) {
+	groups := setupGroups(t, map[string]EthnicGroup{
+		"West African": {Parent: African},
+	})
+
+	// black player from a nation mapped to the custom group
+	ethnic, _, err := EvaluateEthnicRules(groups, DefaultEthnicRules, "West African", "", 3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ethnic != "West African" {
+		t.Fatalf("expected West African, got %q", ethnic)
+	}
+
+	// conditions on the parent match the custom group
+	ethnic, _, err = EvaluateEthnicRules(groups, DefaultEthnicRules, "West African", "", 1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ethnic != SouthAmerican {
+		t.Fatalf("expected South American, got %q", ethnic)
+	}
+}
+
+func TestNewImagePool_CustomGroupFolder(t *testing.T) {
+	groups := setupGroups(t, map[string]EthnicGroup{
+		"Pacific Islander": {Folder: "Pacific"},
+	})
+	root := setupImageRoot(t, "Pacific/face.png")
+
+	pool, err := NewImagePoolWithOptions(root, PoolOptions{Groups: groups})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	image, err := pool.GetRandomImagePath(Player{Ethnic: "Pacific Islander"}, false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if image != "Pacific/face" {
+		t.Fatalf("expected Pacific/face, got %s", image)
+	}
+}
+
+func TestNewImagePool_NestedGroupFolder(t *testing.T) {
+	groups := setupGroups(t, map[string]EthnicGroup{
+		"West African": {Folder: "African/West", Parent: African},
+	})
+	root := setupImageRoot(t, "African/a.png", "African/West/w.png")
+
+	pool, err := NewImagePoolWithOptions(root, PoolOptions{Groups: groups})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if images := pool.pool[African]; len(images) != 1 || images[0].Path != "African/a" {
+		t.Fatalf("expected African/a only, got %v", images)
+	}
+	if images := pool.pool["West African"]; len(images) != 1 || images[0].Path != "African/West/w" {
+		t.Fatalf("expected African/West/w only, got %v", images)
+	}
+}
+
+func TestIsValidEthnic_BuiltIn(t *testing.T) {
+	if !IsValidEthnic(string(African)) || IsValidEthnic("West African") {
+		t.Fatal("expected only built-in groups to be valid")
+	}
+	if !EthnicSet().Contains(Caucasian) || EthnicSet().Cardinality() != len(Ethnicities) {
+		t.Fatalf("expected the built-in groups, got %v", EthnicSet())
+	}
+}
+
+func TestResolver_GroupsAreIsolated(t *testing.T) {
+	groups := setupGroups(t, map[string]EthnicGroup{
+		"West African": {Parent: African},
+	})
+
+	first := NewResolver()
+	first.SetEthnicGroups(groups)
+	if err := OverrideNationEthnicMapping(first, map[string]string{"GHA": "West African"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// a run without the groups, such as another profile, does not see them
+	second := NewResolver()
+	if err := OverrideNationEthnicMapping(second, map[string]string{"GHA": "West African"}); err == nil {
+		t.Fatal("expected an error for a group of another run")
+	}
+
+	root := setupImageRoot(t, "African/a.png")
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(pool.Groups().All()) != len(Ethnicities) {
+		t.Fatalf("expected the built-in groups only, got %v", pool.Groups().All())
+	}
+}
@@ -3,110 +3,453 @@ package mapper
 import (
 	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
 	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strings"
-
-	mapset "github.com/deckarep/golang-set/v2"
 )
 
+// PoolImage is a single face in the pool
+type PoolImage struct {
+	Path FilePath   // relative to the image root and without extension, ex: African/tone-1-5/face
+	Tone ValueRange // skin tones the face is meant for, unset if untagged
+	Age  ValueRange // player ages the face is meant for, unset if untagged
+	Tags ImageTags  // traits read from the metadata sidecars, nil without any
+
+	Priority int // priority of the image root the face was read from
+}
+
 type ImagePool struct {
-	pool map[Ethnic][]FilePath // ex: asian => [relative/path/to/image]
+	pool      map[Ethnic][]PoolImage // ex: asian => [relative/path/to/image]
+	fallbacks map[Ethnic][]Ethnic    // ex: Italmed => [SpanMed, Central European]
+	report    PoolReport             // what reading the image root found
+	usage     map[FilePath]int       // players per image, only tracked in runs allowing duplicates
+	balanced  bool                   // pick among the least used images
+	maxUses   int                    // players an image can be given to, 0 for no cap
+	index     *PoolIndex             // what reading the image root decoded, reused for hashes
+	indexPath string                 // where the index is saved, empty to keep it in memory
+	roots     []string               // additional image roots relative to the main one, ex: ../premium
+	tagRules  []TagRule              // steer players to faces by their tags
+	groups    *EthnicGroups          // ethnic groups the pool has folders for
+}
+
+// PoolOptions controls how the ethnic folders of an image root are read
+type PoolOptions struct {
+	MaxDepth      int           // subfolder levels read below an ethnic folder, 0 for no limit
+	IncludeHidden bool          // read files and folders whose name starts with a dot
+	IndexPath     string        // file caching the decoded images between runs, empty for none
+	Roots         []ImageRoot   // image roots merged into the pool next to the main one
+	Strict        bool          // fail on a missing ethnic folder instead of leaving its group empty
+	Groups        *EthnicGroups // ethnic groups to read the folders of, the built-in ones when nil
 }
 
 func NewImagePool(imageRootPath string) (*ImagePool, error) {
-	pool := make(map[Ethnic][]FilePath)
+	return NewImagePoolWithOptions(imageRootPath, PoolOptions{})
+}
+
+// NewImagePoolWithOptions reads every ethnic folder of the image root and its
+// subfolders, such as African/part1. Image paths keep their subfolders so
+// that the mapping points at the nested file. Files that are not images or
+// cannot be decoded are left out and listed in the pool's Report. Images of
+// additional roots are qualified with the root's path relative to the image
+// root, ex: ../premium/African/face. Missing ethnic folders leave their
+// group empty and are listed in the Report, unless the options are strict
+func NewImagePoolWithOptions(imageRootPath string, options PoolOptions) (*ImagePool, error) {
+	pool := make(map[Ethnic][]PoolImage)
+	index := NewPoolIndex(imageRootPath)
+	if options.IndexPath != "" {
+		index = LoadPoolIndex(options.IndexPath, imageRootPath)
+	}
+	reader := &poolReader{root: imageRootPath, options: options, index: index, files: make(map[FilePath]string)}
+
+	if _, err := os.Stat(imageRootPath); err != nil {
+		return nil, fmt.Errorf("cannot read image folder: %w", err)
+	}
+
+	for _, ethnic := range options.Groups.All() {
+		folder := options.Groups.Folder(ethnic)
+
+		// small packs often lack a few groups, their players use the
+		// fallbacks of the group
+		_, err := os.Stat(filepath.Join(imageRootPath, filepath.FromSlash(folder)))
+		if errors.Is(err, fs.ErrNotExist) && !options.Strict {
+			reader.report.Missing = append(reader.report.Missing, ethnic)
+			pool[ethnic] = []PoolImage{}
+			continue
+		}
 
-	for _, ethnic := range Ethnicities {
-		pool[ethnic] = make([]FilePath, 0)
+		ethnicPool, err := reader.readFolder(folder, folderTraits{}, 0)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("cannot get ethnic folder %s", folder), err)
+		}
+		pool[ethnic] = ethnicPool
+	}
 
-		files, err := os.ReadDir(path.Join(imageRootPath, string(ethnic)))
+	roots := make([]string, 0, len(options.Roots))
+	for _, root := range options.Roots {
+		qualifier, err := reader.readRoot(pool, root)
 		if err != nil {
-			return nil, errors.Join(fmt.Errorf("cannot get ethnic folder %s", ethnic), err)
+			return nil, err
+		}
+		roots = append(roots, qualifier)
+	}
+
+	images := &ImagePool{pool: pool, report: reader.report, index: index, indexPath: options.IndexPath, roots: roots, groups: options.Groups}
+	images.saveIndex()
+	return images, nil
+}
+
+// Groups returns the ethnic groups the pool was read with
+func (images *ImagePool) Groups() *EthnicGroups {
+	if images == nil {
+		return nil
+	}
+	return images.groups
+}
+
+// saveIndex writes the pool index if it is persisted. The index is only a
+// cache, failing to write it slows the next read down but loses nothing
+func (images *ImagePool) saveIndex() {
+	if images.indexPath != "" {
+		_ = images.index.Save(images.indexPath)
+	}
+}
+
+// poolReader reads the folders of an image root and reports the files it
+// leaves out
+type poolReader struct {
+	root    string
+	options PoolOptions
+	report  PoolReport
+	index   *PoolIndex
+	files   map[FilePath]string // file each image path was read from, ex: African/face => African/face.png
+	rootDir string              // qualifier of the additional root being read, empty for the main one
+}
+
+// folderTraits are what a folder passes on to the images below it
+type folderTraits struct {
+	Tone ValueRange
+	Age  ValueRange
+	Tags ImageTags
+}
+
+// readFolder returns the images of a folder relative to the image root and
+// of its subfolders. Skin tone buckets such as tone-1-5 and age bands such
+// as age-16-21 tag the images below them, the innermost bucket wins. Tags of
+// the sidecars apply to the images below them likewise
+func (reader *poolReader) readFolder(dir string, traits folderTraits, depth int) ([]PoolImage, error) {
+	folder, err := reader.index.folder(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var imageTags map[string]ImageTags
+	var sidecars map[string]bool
+	traits.Tags, imageTags, sidecars = reader.folderTags(dir, folder, traits.Tags)
+
+	images := make([]PoolImage, 0, len(folder.Entries))
+	for _, file := range folder.Entries {
+		if !reader.options.IncludeHidden && strings.HasPrefix(file.Name, ".") {
+			continue
 		}
 
-		for _, file := range files {
-			if file.IsDir() {
+		if !file.Folder {
+			if sidecars[file.Name] {
 				continue
 			}
+			imageTraits := traits
+			if ownTags, isTagged := imageTags[strings.TrimSuffix(file.Name, path.Ext(file.Name))]; isTagged {
+				imageTraits.Tags = ownTags
+			}
+			if image, isImage := reader.readImage(dir, file, imageTraits); isImage {
+				images = append(images, image)
+			}
+			continue
+		}
+
+		if reader.options.MaxDepth > 0 && depth >= reader.options.MaxDepth {
+			continue
+		}
 
-			// football manager requires filenames but not filename.png
-			fullFilename := file.Name()
-			filename := strings.TrimSuffix(filepath.Base(fullFilename), filepath.Ext(fullFilename))
+		// the folder of a nested group such as African/West holds that
+		// group's faces only, they must not be handed out as African too
+		if reader.isGroupFolder(path.Join(dir, file.Name)) {
+			continue
+		}
+
+		subfolderTraits := traits
+		if bucketTone, isBucket := parseBucket(toneRegex, file.Name); isBucket {
+			subfolderTraits.Tone = bucketTone
+		}
+		if bucketAge, isBucket := parseBucket(ageRegex, file.Name); isBucket {
+			subfolderTraits.Age = bucketAge
+		}
 
-			pool[ethnic] = append(pool[ethnic], FilePath(filename))
+		subfolderImages, err := reader.readFolder(path.Join(dir, file.Name), subfolderTraits, depth+1)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("cannot get folder %s/%s", dir, file.Name), err)
 		}
+		images = append(images, subfolderImages...)
 	}
 
-	return &ImagePool{pool}, nil
+	return images, nil
 }
 
-func (images *ImagePool) ExcludeImages(excludes []FilePath) error {
-	// set exclude images externally
-	excludeSets := make(map[Ethnic]mapset.Set[FilePath])
+// isGroupFolder reports whether a folder is the folder of an ethnic group
+func (reader *poolReader) isGroupFolder(dir string) bool {
+	if reader.rootDir != "" {
+		dir = strings.TrimPrefix(dir, reader.rootDir+"/")
+	}
+	groups := reader.options.Groups
+	for _, ethnic := range groups.All() {
+		if groups.Folder(ethnic) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// readImage validates a file of the image root. Files that are not images,
+// cannot be decoded or share their path with an image already read are
+// reported instead
+func (reader *poolReader) readImage(dir string, indexed IndexFile, traits folderTraits) (PoolImage, bool) {
+	file := path.Join(dir, indexed.Name)
+
+	if !IsImageFile(indexed.Name) {
+		reader.report.Ignored = append(reader.report.Ignored, file)
+		return PoolImage{}, false
+	}
+
+	if indexed.Invalid != "" {
+		reader.report.Invalid = append(reader.report.Invalid, PoolIssue{File: file, Reason: indexed.Invalid})
+		return PoolImage{}, false
+	}
+	info := ImageInfo{Format: indexed.Format, Width: indexed.Width, Height: indexed.Height}
 
-	for _, ethnic := range Ethnicities {
-		excludeSets[ethnic] = mapset.NewSet[FilePath]()
+	image := newPoolImage(dir, indexed.Name, traits)
+	if first, taken := reader.files[image.Path]; taken {
+		reader.report.Collisions = append(reader.report.Collisions, PoolIssue{File: file, Reason: fmt.Sprintf("same image as %s once the extension is dropped", first)})
+		return PoolImage{}, false
 	}
+	reader.files[image.Path] = file
+
+	info.File = file
+	info.Path = image.Path
+	info.Tags = image.Tags
+	reader.report.Images = append(reader.report.Images, info)
+
+	return image, true
+}
+
+// newPoolImage builds the pool entry for a file inside dir. A tone or age tag
+// in the file name takes precedence over the bucket of its folder, the age
+// tag of the sidecars comes last
+func newPoolImage(dir string, fullFilename string, traits folderTraits) PoolImage {
+	// football manager requires filenames but not filename.png
+	filename := strings.TrimSuffix(filepath.Base(fullFilename), filepath.Ext(fullFilename))
 
-	ethnictiesStrs := make([]string, len(Ethnicities))
-	for i, ethnic := range Ethnicities {
-		ethnictiesStrs[i] = string(ethnic)
+	tone := traits.Tone
+	if fileTone, isTagged := parseBucket(toneRegex, filename); isTagged {
+		tone = fileTone
 	}
-	ethnicRegexPattern := strings.Join(ethnictiesStrs, "|")
-	ethnicRegexPattern = strings.ReplaceAll(ethnicRegexPattern, " ", `\s`)
-	ethnicRegex := regexp.MustCompile(fmt.Sprintf(`\b(%s)\b`, ethnicRegexPattern))
 
-	imageFilenameRegex := regexp.MustCompile(`[^\/]+$`)
-	for _, filePath := range excludes {
-		ethnic := Ethnic(ethnicRegex.FindString(string(filePath)))
-		filename := FilePath(imageFilenameRegex.FindString(string(filePath)))
-		excludeSets[ethnic].Add(filename)
+	age := traits.Age
+	if fileAge, isTagged := parseBucket(ageRegex, filename); isTagged {
+		age = fileAge
+	} else if tagAge, isTagged := parseBucket(rangeRegex, traits.Tags["age"]); isTagged && !age.IsSet() {
+		age = tagAge
 	}
 
+	return PoolImage{Path: FilePath(path.Join(dir, filename)), Tone: tone, Age: age, Tags: traits.Tags}
+}
+
+// clone returns a copy of the pool that can be drawn from without changing
+// the pool
+func (images *ImagePool) clone() *ImagePool {
+	copied := *images
+	copied.pool = make(map[Ethnic][]PoolImage, len(images.pool))
 	for ethnic, ethnicPool := range images.pool {
-		excludeSet, hasSet := excludeSets[Ethnic(ethnic)]
-		if !hasSet {
-			continue
-		}
+		copied.pool[ethnic] = slices.Clone(ethnicPool)
+	}
+	copied.usage = maps.Clone(images.usage)
+	return &copied
+}
 
-		filteredPool := make([]FilePath, 0)
+// ExcludeImages removes images from the pool. Images are given relative to
+// the image root, as in the pool, ex: African/part1/face. Separators and
+// extensions are normalised, images not in the pool are ignored
+func (images *ImagePool) ExcludeImages(excludes []FilePath) {
+	excluded := make(map[FilePath]bool, len(excludes))
+	for _, exclude := range excludes {
+		image := path.Clean(strings.ReplaceAll(string(exclude), "\\", "/"))
+		if IsImageFile(image) {
+			image = strings.TrimSuffix(image, path.Ext(image))
+		}
+		excluded[FilePath(image)] = true
+	}
 
-		for _, filepath := range ethnicPool {
-			if excludeSet.Contains(filepath) {
-				continue // ignore file
+	for ethnic, ethnicPool := range images.pool {
+		filteredPool := make([]PoolImage, 0, len(ethnicPool))
+		for _, image := range ethnicPool {
+			if !excluded[image.Path] {
+				filteredPool = append(filteredPool, image)
 			}
-			filteredPool = append(filteredPool, filepath)
 		}
-
 		images.pool[ethnic] = filteredPool
 	}
+}
+
+// GetRandomImagePath picks an image for the player's ethnic, falling back to
+// the fallback groups when the ethnic pool is missing or exhausted
+func (images *ImagePool) GetRandomImagePath(player Player, removeFromPool bool) (FilePath, error) {
+	filename, _, err := images.GetImagePath(player, removeFromPool)
+	return filename, err
+}
+
+// GetImagePath picks an image for the player and returns the ethnic whose
+// pool served it, which differs from the player's ethnic when a fallback
+// group was used
+func (images *ImagePool) GetImagePath(player Player, removeFromPool bool) (FilePath, Ethnic, error) {
+	chain := images.fallbackChain(player.Ethnic)
+
+	for _, ethnic := range chain {
+		if filename, found := images.pickImage(ethnic, player, removeFromPool); found {
+			return filename, ethnic, nil
+		}
+	}
 
-	return nil
+	if len(chain) > 1 {
+		return "", "", fmt.Errorf("ran out of images for ethnicity: %s and its fallbacks %v", player.Ethnic, chain[1:])
+	}
+	return "", "", fmt.Errorf("ran out of images for ethnicity: %s", player.Ethnic)
 }
 
-func (images *ImagePool) GetRandomImagePath(ethnic Ethnic, removeFromPool bool) (FilePath, error) {
+// pickImage draws an image from the pool of an ethnic. When the player's skin
+// tone is known and the ethnic folder has tone buckets, the image is taken
+// from the closest bucket, otherwise from the whole ethnic pool
+func (images *ImagePool) pickImage(ethnic Ethnic, player Player, removeFromPool bool) (FilePath, bool) {
 	var index int
 
-	length := len(images.pool[ethnic])
+	// capped images are left out before the tone, age and tags narrow the
+	// candidates down, so that their fall back to the whole pool only falls
+	// back to images that can still be given out
+	ethnicPool := images.pool[ethnic]
+	candidates, _ := images.candidates(ethnic, images.usable(ethnic), player.SkinTone)
+	candidates, _ = ageCandidates(ethnicPool, candidates, player.Age)
+
+	candidates, found := images.matchingTags(ethnicPool, candidates, player)
+	if !found {
+		return "", false
+	}
+
+	// the balanced strategy only draws among the least used candidates
+	if images.usage != nil && images.balanced {
+		candidates = images.leastUsed(ethnicPool, candidates)
+	}
+	candidates = images.highestPriority(ethnicPool, candidates)
+
+	length := len(candidates)
 	if length == 0 {
-		return "", fmt.Errorf("ran out of images for ethnicity: %s", ethnic)
+		return "", false
 	} else if length == 1 {
-		index = 0
+		index = candidates[0]
 	} else {
-		index = rand.Intn(length - 1)
+		index = candidates[rand.Intn(length)]
 	}
 
-	filename := images.pool[ethnic][index]
+	filename := ethnicPool[index].Path
+	if images.usage != nil {
+		images.usage[filename]++
+	}
 
 	if removeFromPool {
 		// remove file from ethnic pool
-		images.pool[ethnic][index] = images.pool[ethnic][length-1]
-		images.pool[ethnic] = images.pool[ethnic][:length-1]
+		last := len(ethnicPool) - 1
+		ethnicPool[index] = ethnicPool[last]
+		images.pool[ethnic] = ethnicPool[:last]
+	}
+
+	return filename, true
+}
+
+// usable returns the indexes of the images of an ethnic pool that can still
+// be given out, those under the usage cap
+func (images *ImagePool) usable(ethnic Ethnic) []int {
+	ethnicPool := images.pool[ethnic]
+
+	usable := make([]int, len(ethnicPool))
+	for i := range ethnicPool {
+		usable[i] = i
+	}
+	if images.usage != nil {
+		usable = images.underCap(ethnicPool, usable)
+	}
+	return usable
+}
+
+// candidates returns the indexes of the usable images of an ethnic pool a
+// player with the given skin tone can get and whether they come from a tone
+// bucket
+func (images *ImagePool) candidates(ethnic Ethnic, usable []int, skinTone int) ([]int, bool) {
+	ethnicPool := images.pool[ethnic]
+
+	tones := make([]ValueRange, len(usable))
+	for i, index := range usable {
+		tones[i] = ethnicPool[index].Tone
+	}
+
+	bucket := closestBucket(tones, skinTone)
+	if bucket == nil {
+		return usable, false
+	}
+
+	candidates := make([]int, len(bucket))
+	for i, position := range bucket {
+		candidates[i] = usable[position]
+	}
+	return candidates, true
+}
+
+// PoolTrace describes an ethnic pool considered for a player
+type PoolTrace struct {
+	Ethnic     Ethnic
+	Images     int        // images left in the pool
+	Capped     int        // images left out at the usage cap
+	Candidates int        // usable images matching the player's skin tone
+	Tone       ValueRange // closest skin tone bucket, unset when the whole pool is used
+	Aged       int        // candidates of an age band holding the player's age, 0 when none
+	Rules      []string   // tag rules matching the player
+	Tagged     int        // candidates left by the tag rules
+}
+
+// TracePools lists the pools GetImagePath considers for the player, in the
+// order they are tried
+func (images *ImagePool) TracePools(player Player) []PoolTrace {
+	chain := images.fallbackChain(player.Ethnic)
+	traces := make([]PoolTrace, len(chain))
+
+	for i, ethnic := range chain {
+		usable := images.usable(ethnic)
+		candidates, bucketed := images.candidates(ethnic, usable, player.SkinTone)
+		traces[i] = PoolTrace{Ethnic: ethnic, Images: len(images.pool[ethnic]), Capped: len(images.pool[ethnic]) - len(usable), Candidates: len(candidates)}
+		if bucketed {
+			traces[i].Tone = images.pool[ethnic][candidates[0]].Tone
+		}
+
+		candidates, traces[i].Aged = ageCandidates(images.pool[ethnic], candidates, player.Age)
+
+		for _, rule := range images.tagRules {
+			if rule.matches(player) {
+				traces[i].Rules = append(traces[i].Rules, rule.String())
+			}
+		}
+		tagged, _ := images.matchingTags(images.pool[ethnic], candidates, player)
+		traces[i].Tagged = len(tagged)
 	}
 
-	return filename, nil
+	return traces
 }
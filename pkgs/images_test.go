@@ -0,0 +1,326 @@
+package mapper
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pngBytes encodes a blank PNG of the given size
+func pngBytes(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// setupImageRoot creates an image root with every ethnic folder and the given
+// files, relative to the root. Images are 1x1 PNGs, other files are empty
+func setupImageRoot(t *testing.T, files ...string) string {
+	t.Helper()
+	root := t.TempDir()
+
+	for _, ethnic := range Ethnicities {
+		if err := os.MkdirAll(filepath.Join(root, string(ethnic)), 0755); err != nil {
+			t.Fatalf("failed to create ethnic folder: %v", err)
+		}
+	}
+
+	for _, file := range files {
+		filePath := filepath.Join(root, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("failed to create folder: %v", err)
+		}
+		var content []byte
+		if IsImageFile(file) {
+			content = pngBytes(t, 1, 1)
+		}
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			t.Fatalf("failed to create image: %v", err)
+		}
+	}
+
+	return root
+}
+
+func TestGetRandomImagePath_ClosestToneBucket(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/tone-1-5/light.png",
+		"African/tone-15-20/dark.png",
+		"African/untagged.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for skinTone, expected := range map[int]FilePath{
+		3:  "African/tone-1-5/light",
+		8:  "African/tone-1-5/light",
+		13: "African/tone-15-20/dark",
+	} {
+		image, err := pool.GetRandomImagePath(Player{Ethnic: African, SkinTone: skinTone}, false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if image != expected {
+			t.Fatalf("expected %s for skin tone %d, got %s", expected, skinTone, image)
+		}
+	}
+}
+
+func TestGetRandomImagePath_ToneTagInFilename(t *testing.T) {
+	root := setupImageRoot(t,
+		"Asian/face_tone-4.png",
+		"Asian/face_tone-12.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	image, err := pool.GetRandomImagePath(Player{Ethnic: Asian, SkinTone: 11}, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if image != "Asian/face_tone-12" {
+		t.Fatalf("expected Asian/face_tone-12, got %s", image)
+	}
+
+	// the bucket is exhausted, so the remaining image is used
+	image, err = pool.GetRandomImagePath(Player{Ethnic: Asian, SkinTone: 11}, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if image != "Asian/face_tone-4" {
+		t.Fatalf("expected Asian/face_tone-4, got %s", image)
+	}
+}
+
+func TestGetRandomImagePath_UnknownToneUsesWholePool(t *testing.T) {
+	root := setupImageRoot(t, "Caucasian/untagged.png")
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	image, err := pool.GetRandomImagePath(Player{Ethnic: Caucasian, SkinTone: 7}, false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if image != "Caucasian/untagged" {
+		t.Fatalf("expected Caucasian/untagged, got %s", image)
+	}
+}
+
+func TestNewImagePoolWithOptions_NestedFolders(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/face.png",
+		"African/part1/face.png",
+		"African/part1/tone-1-5/light.png",
+		"African/part1/deeper/part2/face.png",
+		"African/.thumbnails/face.png",
+		"African/.DS_Store",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	images := make(map[FilePath]PoolImage)
+	for _, image := range pool.pool[African] {
+		images[image.Path] = image
+	}
+	for _, expected := range []FilePath{"African/face", "African/part1/face", "African/part1/tone-1-5/light", "African/part1/deeper/part2/face"} {
+		if _, found := images[expected]; !found {
+			t.Fatalf("expected %s in the pool, got %v", expected, pool.pool[African])
+		}
+	}
+	if len(images) != 4 {
+		t.Fatalf("expected hidden files and folders to be skipped, got %v", pool.pool[African])
+	}
+	if tone := images["African/part1/tone-1-5/light"].Tone; tone != (ValueRange{Min: 1, Max: 5}) {
+		t.Fatalf("expected a nested tone bucket to tag its images, got %v", tone)
+	}
+
+	pool, err = NewImagePoolWithOptions(root, PoolOptions{MaxDepth: 1, IncludeHidden: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(pool.pool[African]) != 3 {
+		t.Fatalf("expected the images of the ethnic folder, part1 and the hidden folder, got %v", pool.pool[African])
+	}
+}
+
+func TestNewImagePool_Report(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/face.png",
+		"African/face.jpg",
+		"African/Thumbs.db",
+		"African/config.xml",
+		"African/broken.png",
+		"African/large.png",
+	)
+	if err := os.WriteFile(filepath.Join(root, "African", "large.png"), pngBytes(t, 180, 240), 0644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "African", "broken.png"), []byte("not an image"), 0644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	report := pool.Report()
+	if len(pool.pool[African]) != 2 {
+		t.Fatalf("expected African/face and African/large in the pool, got %v", pool.pool[African])
+	}
+	if len(report.Ignored) != 2 {
+		t.Fatalf("expected Thumbs.db and config.xml to be ignored, got %v", report.Ignored)
+	}
+	if len(report.Invalid) != 1 || report.Invalid[0].File != "African/broken.png" {
+		t.Fatalf("expected African/broken.png to be invalid, got %v", report.Invalid)
+	}
+	// files are read in name order, face.jpg comes first
+	if len(report.Collisions) != 1 || report.Collisions[0].File != "African/face.png" {
+		t.Fatalf("expected African/face.png to collide, got %v", report.Collisions)
+	}
+	if report.Valid() {
+		t.Fatalf("expected the report to be invalid")
+	}
+	for _, info := range report.Images {
+		if info.File == "African/large.png" && (info.Format != "png" || info.Width != 180 || info.Height != 240) {
+			t.Fatalf("expected African/large.png as a 180x240 png, got %+v", info)
+		}
+	}
+}
+
+func TestGetRandomImagePath_PicksEveryImage(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/a.png",
+		"African/b.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	picked := make(map[FilePath]bool)
+	for i := 0; i < 100; i++ {
+		image, err := pool.GetRandomImagePath(Player{Ethnic: African}, false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		picked[image] = true
+	}
+	if len(picked) != 2 {
+		t.Fatalf("expected both images to be picked, got %v", picked)
+	}
+}
+
+func TestExcludeImages(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/face.png",
+		"African/part1/face.png",
+		"African/part1/other.png",
+		"SpanMed/face.png",
+	)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// paths outside of the ethnic folders are ignored rather than panicking
+	pool.ExcludeImages([]FilePath{`African\part1\face.png`, "SpanMed/face", "Unknown/face"})
+
+	if len(pool.pool[African]) != 2 || len(pool.pool[SpanishMediterranean]) != 0 {
+		t.Fatalf("expected African/part1/face and SpanMed/face to be excluded, got %v", pool.pool)
+	}
+	for _, image := range pool.pool[African] {
+		if image.Path == "African/part1/face" {
+			t.Fatalf("expected African/part1/face to be excluded, got %v", pool.pool[African])
+		}
+	}
+}
+
+func TestGetImagePath_AgeBands(t *testing.T) {
+	root := setupImageRoot(t,
+		"African/age-15-19/young.png",
+		"African/old_age-30-40.png",
+		"African/any.png",
+	)
+	writeSidecar(t, root, "African/any.toml", `age = "20-25"`)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := map[int]FilePath{16: "African/age-15-19/young", 35: "African/old_age-30-40", 22: "African/any"}
+	for age, image := range expected {
+		for i := 0; i < 10; i++ {
+			got, _, err := pool.GetImagePath(Player{Ethnic: African, Age: age}, false)
+			if err != nil || got != image {
+				t.Fatalf("expected %s for age %d, got %s %v", image, age, got, err)
+			}
+		}
+	}
+
+	// once the young faces are taken, the whole pool is used
+	for i := 0; i < 3; i++ {
+		if _, _, err := pool.GetImagePath(Player{Ethnic: African, Age: 16}, true); err != nil {
+			t.Fatalf("expected a face for every young player, got %v", err)
+		}
+	}
+}
+
+func TestNewImagePool_MissingFolders(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "SpanMed"), 0755); err != nil {
+		t.Fatalf("failed to create folder: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "SpanMed", "a.png"), pngBytes(t, 1, 1), 0644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+
+	if _, err := NewImagePoolWithOptions(root, PoolOptions{Strict: true}); err == nil {
+		t.Fatalf("expected the strict pool to fail on missing folders")
+	}
+	if _, err := NewImagePool(filepath.Join(root, "none")); err == nil {
+		t.Fatalf("expected an error for a missing image folder")
+	}
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if missing := pool.Report().Missing; len(missing) != len(Ethnicities)-1 {
+		t.Fatalf("expected every folder but SpanMed to be missing, got %v", missing)
+	}
+	if err := pool.SetFallbacks(map[string][]string{string(ItalianMediterranean): {string(SpanishMediterranean)}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{}}
+	result := AssignImages(mapping, pool, []Player{{ID: "1", Ethnic: ItalianMediterranean}, {ID: "2", Ethnic: African}}, AssignOptions{})
+	if mapping.idImageMap["1"] != "SpanMed/a" || len(result.Errors) != 1 || len(result.Missing) != len(Ethnicities)-1 {
+		t.Fatalf("expected the Italmed player to fall back to SpanMed and the African one to fail, got %v %+v", mapping.idImageMap, result)
+	}
+	if !strings.Contains(result.String(), "Missing ethnic folders") {
+		t.Fatalf("expected the missing folders in the summary, got %s", result)
+	}
+}
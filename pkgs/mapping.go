@@ -96,6 +96,12 @@ func (m *Mapping) Exist(id PlayerID) bool {
 	return ok
 }
 
+// Image returns the image mapped to a player
+func (m *Mapping) Image(id PlayerID) (FilePath, bool) {
+	filepath, ok := m.idImageMap[id]
+	return filepath, ok
+}
+
 func (m *Mapping) MapToImage(id PlayerID, filepath FilePath) {
 	m.idImageMap[id] = filepath
 }
@@ -0,0 +1,146 @@
+package mapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// NationTableVersions lists the FM versions with a built-in nation table,
+// newest first
+var NationTableVersions = []string{"2024", "2023", "2022", "2021", "2020"}
+
+// nationTableDelta is how the built-in table of an FM version differs from
+// NationEthnicMapping, which holds the codes of every edition
+type nationTableDelta struct {
+	removed []string          // codes the edition does not use
+	aliases map[string]string // codes resolving to one the edition uses, ex: XKX => KOS
+}
+
+// kosovoAsKOS and kosovoAsKVX are the codes of Kosovo before and after the
+// editions switched to the FIFA code
+var (
+	kosovoAsKOS = nationTableDelta{removed: []string{"KVX"}, aliases: map[string]string{"KVX": "KOS", "XKX": "KOS"}}
+	kosovoAsKVX = nationTableDelta{removed: []string{"KOS"}, aliases: map[string]string{"KOS": "KVX", "XKX": "KVX"}}
+)
+
+// nationTableDeltas holds the delta of every version of NationTableVersions
+var nationTableDeltas = map[string]nationTableDelta{
+	"2024": kosovoAsKVX,
+	"2023": kosovoAsKVX,
+	"2022": kosovoAsKOS,
+	"2021": kosovoAsKOS,
+	"2020": kosovoAsKOS,
+}
+
+// NationTable is the nation to ethnic table of an FM version. Aliases let old
+// or alternative codes resolve to a code of the table
+type NationTable struct {
+	Version string            `toml:"version" json:"version"`
+	Nations map[string]Ethnic `toml:"nations" json:"nations"`
+	Aliases map[string]string `toml:"aliases,omitempty" json:"aliases,omitempty"` // ex: XKX => KOS
+}
+
+// BuiltinNationTable returns a copy of the built-in table of an FM version,
+// with the codes of that edition. Versions without a built-in table, such as
+// editions released after the tool, need an imported table
+func BuiltinNationTable(version string) (NationTable, error) {
+	delta, isKnown := nationTableDeltas[version]
+	if !isKnown {
+		return NationTable{}, fmt.Errorf("no built-in nation table for FM %s, known versions are %s", version, strings.Join(NationTableVersions, ", "))
+	}
+
+	nations := maps.Clone(NationEthnicMapping)
+	for _, nation := range delta.removed {
+		delete(nations, nation)
+	}
+
+	return NationTable{
+		Version: version,
+		Nations: nations,
+		Aliases: maps.Clone(delta.aliases),
+	}, nil
+}
+
+// Validate checks that every nation maps to a valid ethnic of the groups and
+// every alias resolves to a nation of the table
+func (table NationTable) Validate(groups *EthnicGroups) error {
+	tableErrors := []error{}
+
+	if table.Version == "" {
+		tableErrors = append(tableErrors, errors.New("nation table has no version"))
+	}
+	if len(table.Nations) == 0 {
+		tableErrors = append(tableErrors, errors.New("nation table has no nations"))
+	}
+
+	for _, nation := range sortedKeys(table.Nations) {
+		if ethnic := table.Nations[nation]; !groups.IsValid(string(ethnic)) {
+			tableErrors = append(tableErrors, fmt.Errorf(`ethnic value "%s" is not valid ethnic for "%s"`, ethnic, nation))
+		}
+	}
+
+	for _, alias := range sortedKeys(table.Aliases) {
+		target := table.Aliases[alias]
+		if _, isNation := table.Nations[alias]; isNation {
+			tableErrors = append(tableErrors, fmt.Errorf(`alias "%s" is also a nation of the table`, alias))
+		}
+		if _, isNation := table.Nations[target]; !isNation {
+			tableErrors = append(tableErrors, fmt.Errorf(`alias "%s" points to unknown nation "%s"`, alias, target))
+		}
+	}
+
+	return errors.Join(tableErrors...)
+}
+
+// ParseNationTable reads a nation table in TOML, or in JSON when format is
+// "json", mapping nations to the given ethnic groups
+func ParseNationTable(data []byte, format string, groups *EthnicGroups) (NationTable, error) {
+	var table NationTable
+
+	var err error
+	if format == "json" {
+		err = json.Unmarshal(data, &table)
+	} else {
+		err = toml.Unmarshal(data, &table)
+	}
+	if err != nil {
+		return NationTable{}, errors.Join(errors.New("cannot parse nation table"), err)
+	}
+
+	if err := table.Validate(groups); err != nil {
+		return NationTable{}, err
+	}
+
+	return table, nil
+}
+
+// MarshalNationTable writes a nation table in the format read by ParseNationTable
+func MarshalNationTable(table NationTable, format string) ([]byte, error) {
+	if format == "json" {
+		return json.MarshalIndent(table, "", "  ")
+	}
+	return toml.Marshal(table)
+}
+
+// NationTableFormat returns the format of a nation table file from its extension
+func NationTableFormat(path string) string {
+	if strings.HasSuffix(strings.ToLower(path), ".json") {
+		return "json"
+	}
+	return "toml"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,107 @@
+package mapper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNationTable_Aliases(t *testing.T) {
+
+	table, err := ParseNationTable([]byte(`
+version = '2025'
+
+[nations]
+KOS = 'YugoGreek'
+FRA = 'Central European'
+
+[aliases]
+XKX = 'KOS'
+`), "toml", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	resolver := NewTableResolver(table)
+	if err := OverrideNationEthnicMapping(resolver, map[string]string{"XKX:3": "African"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// the alias resolves to the nation of the table
+	if ethnic, err := getEthnic(resolver, "XKX", "", 0); err != nil || ethnic != CentralEuropean {
+		t.Fatalf("expected Central European, got %q (%v)", ethnic, err)
+	}
+
+	// overrides given on the alias apply to the nation
+	if ethnic, err := getEthnic(resolver, "KOS", "", 3); err != nil || ethnic != African {
+		t.Fatalf("expected African, got %q (%v)", ethnic, err)
+	}
+}
+
+func TestParseNationTable_Invalid(t *testing.T) {
+
+	_, err := ParseNationTable([]byte(`{
+		"version": "2024",
+		"nations": {"FRA": "Martian"},
+		"aliases": {"FRA": "FRA", "XKX": "KOS"}
+	}`), "json", nil)
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+
+	for _, expectedErrorMsg := range []string{
+		`ethnic value "Martian" is not valid ethnic for "FRA"`,
+		`alias "FRA" is also a nation of the table`,
+		`alias "XKX" points to unknown nation "KOS"`,
+	} {
+		if !strings.Contains(err.Error(), expectedErrorMsg) {
+			t.Fatalf("expected error message to contain %q, got %q", expectedErrorMsg, err.Error())
+		}
+	}
+}
+
+func TestBuiltinNationTable_RoundTrip(t *testing.T) {
+	builtin, err := BuiltinNationTable("2023")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	data, err := MarshalNationTable(builtin, "toml")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	table, err := ParseNationTable(data, "toml", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if table.Version != "2023" || len(table.Nations) != len(builtin.Nations) || table.Aliases["XKX"] != "KVX" {
+		t.Fatalf("expected the built-in 2023 table back, got version %s with %d nations", table.Version, len(table.Nations))
+	}
+}
+
+func TestBuiltinNationTable_Versions(t *testing.T) {
+	older, err := BuiltinNationTable("2021")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	newer, err := BuiltinNationTable("2024")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Kosovo changed code between the editions
+	if _, found := older.Nations["KOS"]; !found || older.Aliases["KVX"] != "KOS" {
+		t.Fatalf("expected KOS in the 2021 table, got %v", older.Aliases)
+	}
+	if _, found := newer.Nations["KOS"]; found || newer.Aliases["KOS"] != "KVX" {
+		t.Fatalf("expected KOS to resolve to KVX in the 2024 table, got %v", newer.Aliases)
+	}
+	for _, table := range []NationTable{older, newer} {
+		if err := table.Validate(nil); err != nil {
+			t.Fatalf("expected a valid %s table, got %v", table.Version, err)
+		}
+	}
+
+	if _, err := BuiltinNationTable("2031"); err == nil {
+		t.Fatal("expected an error for an unknown version")
+	}
+}
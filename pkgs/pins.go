@@ -0,0 +1,126 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// PlayerPin fixes the ethnic or the image of a single player, whatever the
+// export and the preserve setting say
+type PlayerPin struct {
+	Ethnic Ethnic   `toml:"ethnic,omitempty"`
+	Image  FilePath `toml:"image,omitempty"` // relative to the image root and without extension, ex: African/face_0012
+}
+
+func (pin PlayerPin) String() string {
+	if pin.Image != "" {
+		return fmt.Sprintf("image %s", pin.Image)
+	}
+	return fmt.Sprintf("ethnic %s", pin.Ethnic)
+}
+
+// NewPlayerPins validates the player_overrides of the config, keyed by UID,
+// against the ethnic groups of the run
+func NewPlayerPins(overrides map[string]PlayerPin, groups *EthnicGroups) (map[PlayerID]PlayerPin, error) {
+	pinErrors := []error{}
+	pins := make(map[PlayerID]PlayerPin)
+	owners := make(map[FilePath]string)
+
+	uids := make([]string, 0, len(overrides))
+	for uid := range overrides {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	for _, uid := range uids {
+		pin := overrides[uid]
+
+		switch {
+		case uid == "" || strings.Trim(uid, "0123456789") != "":
+			pinErrors = append(pinErrors, fmt.Errorf(`player override "%s" is not a player UID`, uid))
+			continue
+		case pin.Ethnic == "" && pin.Image == "":
+			pinErrors = append(pinErrors, fmt.Errorf(`player override "%s" has neither an ethnic nor an image`, uid))
+			continue
+		case pin.Ethnic != "" && pin.Image != "":
+			pinErrors = append(pinErrors, fmt.Errorf(`player override "%s" has both an ethnic and an image`, uid))
+			continue
+		case pin.Ethnic != "" && !groups.IsValid(string(pin.Ethnic)):
+			pinErrors = append(pinErrors, fmt.Errorf(`ethnic value "%s" is not valid ethnic for player "%s"`, pin.Ethnic, uid))
+			continue
+		}
+
+		// images are referred to like in the mapping, without extension
+		if pin.Image != "" {
+			image := path.Clean(strings.ReplaceAll(string(pin.Image), "\\", "/"))
+			pin.Image = FilePath(strings.TrimSuffix(image, path.Ext(image)))
+
+			if owner, taken := owners[pin.Image]; taken {
+				pinErrors = append(pinErrors, fmt.Errorf(`image "%s" is pinned to both "%s" and "%s"`, pin.Image, owner, uid))
+				continue
+			}
+			owners[pin.Image] = uid
+		}
+
+		pins[PlayerID(uid)] = pin
+	}
+
+	if len(pinErrors) > 0 {
+		return nil, errors.Join(pinErrors...)
+	}
+
+	return pins, nil
+}
+
+// pinnedImages returns the images pinned to a player
+func pinnedImages(pins map[PlayerID]PlayerPin) map[FilePath]PlayerID {
+	images := make(map[FilePath]PlayerID)
+	for id, pin := range pins {
+		if pin.Image != "" {
+			images[pin.Image] = id
+		}
+	}
+	return images
+}
+
+// unknownPins reports the pinned images that are not in the pool, such as a
+// mistyped African/face_012, sorted by player
+func (images *ImagePool) unknownPins(pinned map[FilePath]PlayerID) []error {
+	known := make(map[FilePath]bool)
+	for _, ethnicPool := range images.pool {
+		for _, image := range ethnicPool {
+			known[image.Path] = true
+		}
+	}
+
+	unknown := make([]FilePath, 0)
+	for image := range pinned {
+		if !known[image] {
+			unknown = append(unknown, image)
+		}
+	}
+	sort.Slice(unknown, func(i, j int) bool { return pinned[unknown[i]] < pinned[unknown[j]] })
+
+	pinErrors := make([]error, len(unknown))
+	for i, image := range unknown {
+		pinErrors[i] = fmt.Errorf("player %s: pinned image %s is not in the image folder", pinned[image], image)
+	}
+	return pinErrors
+}
+
+// reserveImages removes the given images from the pool so that they are not
+// handed out to other players
+func (images *ImagePool) reserveImages(reserved map[FilePath]PlayerID) {
+	for ethnic, ethnicPool := range images.pool {
+		filteredPool := make([]PoolImage, 0, len(ethnicPool))
+		for _, image := range ethnicPool {
+			if _, isReserved := reserved[image.Path]; !isReserved {
+				filteredPool = append(filteredPool, image)
+			}
+		}
+		images.pool[ethnic] = filteredPool
+	}
+}
@@ -2,140 +2,330 @@ package mapper
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+
+	mapset "github.com/deckarep/golang-set/v2"
 )
 
 var ErrBadRTFFormat string = "bad RTF Format:\n%w"
 
-func getEthnic(nationality1, nationality2 string, ethnicValue int) (Ethnic, error) {
-	ethnic1, ok := NationEthnicMapping[nationality1]
-	if !ok {
-		return "", fmt.Errorf("ethnic not found for country initials: %s", nationality1)
-	}
+// EthnicTrace records how getEthnic decided a player's ethnic
+type EthnicTrace struct {
+	Ethnic1     Ethnic        // group of the first nationality, empty when unknown
+	Ethnic2     Ethnic        // group of the second nationality, empty when unknown
+	Overridden  []string      // nationalities whose group was set by a mapping override, ex: FRA
+	OverrideKey string        // mapping override deciding on its own or drawing the result, ex: "FRA:0"
+	Weights     EthnicWeights // distribution of that override
+	RuleIndex   int           // rule that fired, -1 when none did
+	RuleResult  Ethnic        // ethnic given by the rule before any weighted draw
+	Warning     string        // set when the unknown nationality policy stepped in
+}
 
-	ethnic2 := NationEthnicMapping[nationality2]
+func getEthnic(resolver *Resolver, nationality1, nationality2 string, ethnicValue int) (Ethnic, error) {
+	ethnic, _, err := traceEthnic(resolver, nationality1, nationality2, ethnicValue)
+	return ethnic, err
+}
 
-	hasEthnic := func(ethnic Ethnic) bool {
-		return ethnic1 == ethnic || ethnic2 == ethnic
-	}
+// traceEthnic decides a player's ethnic and records each step taken
+func traceEthnic(resolver *Resolver, nationality1, nationality2 string, ethnicValue int) (Ethnic, EthnicTrace, error) {
+	trace := EthnicTrace{RuleIndex: -1}
 
-	switch ethnicValue {
-	case 0:
-		if hasEthnic(Scandinavian) {
-			return Scandinavian, nil
-		}
-		if hasEthnic(Caucasian) {
-			return Caucasian, nil
-		}
-		return CentralEuropean, nil
-	case 1:
-		if hasEthnic(Scandinavian) ||
-			hasEthnic(SouthEastAsian) ||
-			hasEthnic(CentralEuropean) ||
-			hasEthnic(Caucasian) ||
-			hasEthnic(African) ||
-			hasEthnic(Asian) ||
-			hasEthnic(MiddleEastNorthAfrican) ||
-			hasEthnic(MiddleEastSouthAsian) ||
-			hasEthnic(EasternEuropeanCentralAsian) {
-			return SouthAmerican, nil
-		}
-		if ethnic1 != "" {
-			return ethnic1, nil
-		}
-		return ethnic2, nil
-	case 2:
-		if hasEthnic(MiddleEastSouthAsian) {
-			return MiddleEastSouthAsian, nil
-		}
-		return MiddleEastNorthAfrican, nil
-	case 3, 6, 7, 8, 9:
-		if ethnicValue == 7 {
-			if ethnic1 == SouthAmericanMediterranean {
-				return SouthAmericanMediterranean, nil
-			}
-			if ethnic1 == SouthAmerican {
-				return SouthAmerican, nil
-			}
+	// old or alternative codes are looked up under the code of the table
+	nationality1 = resolver.canonical(nationality1)
+	nationality2 = resolver.canonical(nationality2)
+
+	trace.Ethnic1 = resolver.nations[nationality1]
+	trace.Ethnic2 = resolver.nations[nationality2]
+	for _, nationality := range []string{nationality1, nationality2} {
+		if resolver.overridden[nationality] {
+			trace.Overridden = append(trace.Overridden, nationality)
 		}
-		return African, nil
-	case 4:
-		return MiddleEastSouthAsian, nil
-	case 5:
-		return SouthEastAsian, nil
-	case 10:
-		if ethnic1 == SouthAmerican {
-			return SouthAmerican, nil
+	}
+
+	// a nation and ethnic value override decides on its own
+	if weights, ok := resolver.weights[pairKey(nationality1, ethnicValue)]; ok {
+		trace.OverrideKey = pairKey(nationality1, ethnicValue)
+		trace.Weights = weights
+		return weights.Sample(), trace, nil
+	}
+
+	ethnic1, ethnic2 := trace.Ethnic1, trace.Ethnic2
+	if ethnic1 == "" {
+		switch {
+		case resolver.unknownPolicy == UnknownNationUseSecond && ethnic2 != "":
+			// the second nationality takes the place of the first one
+			trace.Warning = fmt.Sprintf("unknown nationality %s, resolved from second nationality %s", nationality1, nationality2)
+			nationality1, nationality2 = nationality2, ""
+			ethnic1, ethnic2 = ethnic2, ""
+		case resolver.unknownPolicy == UnknownNationDefaultGroup:
+			trace.Warning = fmt.Sprintf("unknown nationality %s, resolved as %s", nationality1, resolver.unknownEthnic)
+			nationality1 = ""
+			ethnic1 = resolver.unknownEthnic
+		default:
+			return "", trace, fmt.Errorf("ethnic not found for country initials: %s", nationality1)
 		}
-		return Asian, nil
-	default:
-		return "", fmt.Errorf("ethnic value not found: %d", ethnicValue)
 	}
+
+	ethnic, ruleIndex, err := EvaluateEthnicRules(resolver.groups, resolver.rules, ethnic1, ethnic2, ethnicValue)
+	if err != nil {
+		return "", trace, err
+	}
+	trace.RuleIndex = ruleIndex
+	trace.RuleResult = ethnic
+
+	// rules see the dominant ethnic of weighted nations, when the rule took
+	// that ethnic from the nation it is drawn from the nation's distribution
+	// instead
+	rule := resolver.rules[ruleIndex]
+	if weights, ok := resolver.weights[nationality1]; ok && fromNationality(resolver.groups, rule, ethnic, ethnic1, true) {
+		trace.OverrideKey = nationality1
+		trace.Weights = weights
+		return weights.Sample(), trace, nil
+	}
+	if weights, ok := resolver.weights[nationality2]; ok && fromNationality(resolver.groups, rule, ethnic, ethnic2, false) {
+		trace.OverrideKey = nationality2
+		trace.Weights = weights
+		return weights.Sample(), trace, nil
+	}
+
+	return ethnic, trace, nil
 }
 
-func GetPlayers(rtfPath string) ([]Player, error) {
+// fromNationality reports whether a rule gave ethnic because it is the group
+// of a nationality, by returning that group or by being gated on it. Rules
+// deciding from the ethnic value alone, such as "black" giving African, do
+// not
+func fromNationality(groups *EthnicGroups, rule EthnicRule, ethnic, nationalityEthnic Ethnic, first bool) bool {
+	if ethnic == "" || ethnic != nationalityEthnic {
+		return false
+	}
+	if rule.Result == RuleResultNationality {
+		return true
+	}
+	return (first && containsKindOf(groups, rule.First, ethnic)) || containsKindOf(groups, rule.Either, ethnic)
+}
+
+func GetPlayers(resolver *Resolver, rtfPath string) ([]Player, error) {
+	players, getEthnicErrors, err := readPlayerFile(resolver, rtfPath, EncodingAuto)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(getEthnicErrors) > 0 {
+		return nil, fmt.Errorf(ErrBadRTFFormat, errors.Join(getEthnicErrors...))
+	}
+
+	return players, nil
+}
+
+var uidRegex = regexp.MustCompile("([0-9]){7,}")
+
+// parsePlayerRow splits an RTF line into its trimmed columns. Lines without a
+// player UID are not player rows and give nil columns
+func parsePlayerRow(rtfLine string) (PlayerID, []string, error) {
+	uidByte := uidRegex.Find([]byte(rtfLine))
+	if uidByte == nil {
+		return "", nil, nil
+	}
+
+	rtfData := strings.Split(rtfLine, "|")
+	if len(rtfData) < 8 {
+		return "", nil, fmt.Errorf(ErrBadRTFFormat, fmt.Errorf("not enough lines in RTF line: %s", rtfLine))
+	}
+
+	for rtfDataIndex := range rtfData {
+		rtfData[rtfDataIndex] = strings.Trim(rtfData[rtfDataIndex], " ")
+	}
+
+	return PlayerID(uidByte), rtfData, nil
+}
+
+// playerAge reads the optional age column added after the ethnic value.
+// Exports of the view without it have an empty cell there, giving 0
+func playerAge(rtfData []string) int {
+	if len(rtfData) < 9 {
+		return 0
+	}
+	age, _ := strconv.Atoi(rtfData[8])
+	return age
+}
+
+// readPlayerFile parses every player row of a single RTF export. Rows whose
+// ethnic cannot be determined are collected separately so that callers can
+// report them all at once
+func readPlayerFile(resolver *Resolver, rtfPath string, encodingName string) ([]Player, []error, error) {
 	players := make([]Player, 0)
 
-	rtfFile, rtfErr := os.Open(rtfPath)
+	rtfBytes, rtfErr := os.ReadFile(rtfPath)
 	if rtfErr != nil {
-		return nil, rtfErr
+		return nil, nil, rtfErr
 	}
-	defer rtfFile.Close()
 
-	UIDRegex := regexp.MustCompile("([0-9]){7,}")
+	// exports are transcoded to UTF-8 first, otherwise UTF-16 files never
+	// match the UID regex and accented names come out garbled
+	rtfBytes, rtfErr = DecodePlayerFile(rtfBytes, encodingName)
+	if rtfErr != nil {
+		return nil, nil, rtfErr
+	}
 
 	getEthnicErrors := make([]error, 0)
 
-	rtfScanner := bufio.NewScanner(rtfFile)
+	rtfScanner := bufio.NewScanner(bytes.NewReader(rtfBytes))
 	for rtfScanner.Scan() {
-		rtfLine := rtfScanner.Text()
-		uidByte := UIDRegex.Find([]byte(rtfLine))
-
-		if uidByte != nil {
-			id := string(uidByte)
-
-			rtfData := strings.Split(rtfLine, "|")
-			if len(rtfData) < 8 {
-				return nil, fmt.Errorf(ErrBadRTFFormat, fmt.Errorf("not enough lines in RTF line: %s", rtfLine))
-			}
-
-			for rtfDataIndex := range rtfData {
-				rtfData[rtfDataIndex] = strings.Trim(rtfData[rtfDataIndex], " ")
-			}
+		id, rtfData, err := parsePlayerRow(rtfScanner.Text())
+		if err != nil {
+			return nil, nil, err
+		}
 
+		if rtfData != nil {
 			ethnicValue, ethniceValueErr := strconv.Atoi(rtfData[7])
 			if ethniceValueErr != nil {
-				return nil, ethniceValueErr
+				return nil, nil, ethniceValueErr
 			}
 
+			// the skin tone column is optional input for image selection,
+			// an unreadable value is treated as unknown
+			skinTone, _ := strconv.Atoi(rtfData[6])
+
 			nationality1 := rtfData[2]
 			nationality2 := rtfData[3]
 
-			ethnic, err := getEthnic(nationality1, nationality2, ethnicValue)
+			ethnic, trace, err := traceEthnic(resolver, nationality1, nationality2, ethnicValue)
 			if err != nil {
 				getEthnicErrors = append(getEthnicErrors, err)
 				continue
 			}
 
 			players = append(players, Player{
-				ID:     PlayerID(id),
-				Ethnic: ethnic,
+				ID:                id,
+				Ethnic:            ethnic,
+				Nationality:       nationality1,
+				SecondNationality: nationality2,
+				EthnicValue:       ethnicValue,
+				SkinTone:          skinTone,
+				Age:               playerAge(rtfData),
+				Source:            rtfPath,
+				Warning:           trace.Warning,
 			})
 		}
 	}
 
-	if len(getEthnicErrors) > 0 {
-		return nil, fmt.Errorf(ErrBadRTFFormat, errors.Join(getEthnicErrors...))
+	if rtfScannerErr := rtfScanner.Err(); rtfScannerErr != nil {
+		return nil, nil, rtfScannerErr
 	}
 
-	if rtfScannerErr := rtfScanner.Err(); rtfScannerErr != nil {
-		return nil, rtfScannerErr
+	return players, getEthnicErrors, nil
+}
+
+// PlayerConflict describes a player ID that was exported more than once with
+// differing nationalities or ethnic values
+type PlayerConflict struct {
+	ID      PlayerID
+	Kept    Player
+	Ignored Player
+}
+
+func (c PlayerConflict) String() string {
+	describe := func(p Player) string {
+		return fmt.Sprintf("%s/%s ethnic value %d (%s)", p.Nationality, p.SecondNationality, p.EthnicValue, p.Source)
 	}
+	return fmt.Sprintf("player %s: kept %s, ignored %s", c.ID, describe(c.Kept), describe(c.Ignored))
+}
 
-	return players, nil
+// SplitPlayerFiles splits an rtf_path setting into its individual entries.
+// Multiple paths or glob patterns are separated by ";"
+func SplitPlayerFiles(rtfPath string) []string {
+	patterns := make([]string, 0)
+	for _, pattern := range strings.Split(rtfPath, ";") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// ExpandPlayerFiles resolves paths and glob patterns into a sorted list of
+// distinct RTF files. A plain path that does not exist is kept so that reading
+// it reports a proper error, while a glob that matches nothing is an error
+func ExpandPlayerFiles(patterns []string) ([]string, error) {
+	seen := mapset.NewSet[string]()
+	files := make([]string, 0)
+
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid player file pattern %q: %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no player files match %q", pattern)
+			}
+			sort.Strings(matches)
+		}
+
+		for _, match := range matches {
+			if seen.Add(filepath.Clean(match)) {
+				files = append(files, match)
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New("no player files given")
+	}
+
+	return files, nil
+}
+
+// GetPlayersFromFiles reads several RTF exports and merges them into one
+// player list. Players are de-duplicated by ID, the first row seen wins and
+// rows that disagree on nationalities or ethnic value are returned as conflicts.
+// encodingName is passed on to DecodePlayerFile
+func GetPlayersFromFiles(resolver *Resolver, rtfPaths []string, encodingName string) ([]Player, []PlayerConflict, error) {
+	players := make([]Player, 0)
+	conflicts := make([]PlayerConflict, 0)
+	indexByID := make(map[PlayerID]int)
+
+	getEthnicErrors := make([]error, 0)
+
+	for _, rtfPath := range rtfPaths {
+		filePlayers, fileErrors, err := readPlayerFile(resolver, rtfPath, encodingName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", rtfPath, err)
+		}
+		getEthnicErrors = append(getEthnicErrors, fileErrors...)
+
+		for _, player := range filePlayers {
+			index, exists := indexByID[player.ID]
+			if !exists {
+				indexByID[player.ID] = len(players)
+				players = append(players, player)
+				continue
+			}
+
+			kept := players[index]
+			if kept.Nationality != player.Nationality ||
+				kept.SecondNationality != player.SecondNationality ||
+				kept.EthnicValue != player.EthnicValue {
+				conflicts = append(conflicts, PlayerConflict{ID: player.ID, Kept: kept, Ignored: player})
+			}
+		}
+	}
+
+	if len(getEthnicErrors) > 0 {
+		return nil, nil, fmt.Errorf(ErrBadRTFFormat, errors.Join(getEthnicErrors...))
+	}
+
+	return players, conflicts, nil
 }
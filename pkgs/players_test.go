@@ -0,0 +1,139 @@
+package mapper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const rtfHeader = `| UID       | Nat       | 2nd Nat   | Name                       |           |           |           | 
+| ---------------------------------------------------------------------------------------------------| 
+`
+
+func setupPlayers() *Resolver {
+	resolver := NewResolver()
+	resolver.nations = map[string]Ethnic{
+		"ESP": SpanishMediterranean,
+		"FRA": CentralEuropean,
+		"GER": CentralEuropean,
+		"COD": African,
+	}
+	return resolver
+}
+
+func writeRTF(t *testing.T, dir, name, rows string) string {
+	t.Helper()
+	rtfPath := filepath.Join(dir, name)
+	if err := os.WriteFile(rtfPath, []byte(rtfHeader+rows), 0644); err != nil {
+		t.Fatalf("failed to write RTF file: %v", err)
+	}
+	return rtfPath
+}
+
+func TestGetPlayersFromFiles_MergesAndDeduplicates(t *testing.T) {
+	resolver := setupPlayers()
+	dir := t.TempDir()
+
+	writeRTF(t, dir, "spain.rtf", "| 2000134233| ESP       |           | Tomeu                      | 1         | 9         | 0         | \n")
+	writeRTF(t, dir, "france.rtf", "| 2000133376| FRA       | COD       | Isaac Ngoy                 | 1         | 5         | 3         | \n"+
+		"| 2000134233| ESP       |           | Tomeu                      | 1         | 9         | 0         | \n")
+
+	files, err := ExpandPlayerFiles(SplitPlayerFiles(filepath.Join(dir, "*.rtf")))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+
+	players, conflicts, err := GetPlayersFromFiles(resolver, files, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(players) != 2 {
+		t.Fatalf("expected 2 players, got %d", len(players))
+	}
+	if len(conflicts) != 0 {
+		t.Fatalf("expected no conflicts, got %v", conflicts)
+	}
+}
+
+func TestGetPlayersFromFiles_ReportsConflicts(t *testing.T) {
+	resolver := setupPlayers()
+	dir := t.TempDir()
+
+	first := writeRTF(t, dir, "a.rtf", "| 2000134233| ESP       |           | Tomeu                      | 1         | 9         | 0         | \n")
+	second := writeRTF(t, dir, "b.rtf", "| 2000134233| GER       |           | Tomeu                      | 1         | 9         | 3         | \n")
+
+	players, conflicts, err := GetPlayersFromFiles(resolver, []string{first, second}, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(players) != 1 || players[0].Nationality != "ESP" {
+		t.Fatalf("expected the first row to be kept, got %v", players)
+	}
+	if len(conflicts) != 1 || conflicts[0].Ignored.Source != second {
+		t.Fatalf("expected one conflict from %s, got %v", second, conflicts)
+	}
+}
+
+func TestExpandPlayerFiles_NoMatch(t *testing.T) {
+	_, err := ExpandPlayerFiles([]string{filepath.Join(t.TempDir(), "*.rtf")})
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+}
+
+func TestGetPlayersFromFiles_UnknownNationPolicy(t *testing.T) {
+	dir := t.TempDir()
+	rtfPath := writeRTF(t, dir, "unknown.rtf", "| 2000133376| XXX       | ESP       | Isaac Ngoy                 | 1         | 5         | 1         | \n")
+
+	resolver := setupPlayers()
+	if _, _, err := GetPlayersFromFiles(resolver, []string{rtfPath}, EncodingAuto); err == nil {
+		t.Fatalf("expected the strict policy to fail on an unknown nationality")
+	}
+
+	if err := resolver.SetUnknownNationPolicy(UnknownNationUseSecond, ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	players, _, err := GetPlayersFromFiles(resolver, []string{rtfPath}, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if players[0].Ethnic != SpanishMediterranean || players[0].Warning == "" {
+		t.Fatalf("expected SpanishMediterranean with a warning, got %s %q", players[0].Ethnic, players[0].Warning)
+	}
+
+	if err := resolver.SetUnknownNationPolicy(UnknownNationDefaultGroup, "Unknown"); err == nil {
+		t.Fatalf("expected an error for an invalid default group")
+	}
+	if err := resolver.SetUnknownNationPolicy(UnknownNationDefaultGroup, ItalianMediterranean); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	players, _, err = GetPlayersFromFiles(resolver, []string{rtfPath}, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if players[0].Ethnic != ItalianMediterranean || players[0].Warning == "" {
+		t.Fatalf("expected Italmed with a warning, got %s %q", players[0].Ethnic, players[0].Warning)
+	}
+}
+
+func TestGetPlayersFromFiles_Age(t *testing.T) {
+	dir := t.TempDir()
+	rtfPath := writeRTF(t, dir, "ages.rtf", "| 2000134233| ESP       |           | Tomeu                      | 1         | 9         | 0         | 16        | \n"+
+		"| 2000133376| FRA       | COD       | Isaac Ngoy                 | 1         | 5         | 3         | \n")
+
+	players, _, err := GetPlayersFromFiles(setupPlayers(), []string{rtfPath}, EncodingAuto)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ages := make(map[PlayerID]int)
+	for _, player := range players {
+		ages[player.ID] = player.Age
+	}
+	if ages["2000134233"] != 16 || ages["2000133376"] != 0 {
+		t.Fatalf("expected ages 16 and unknown, got %v", ages)
+	}
+}
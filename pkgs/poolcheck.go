@@ -0,0 +1,84 @@
+package mapper
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	_ "golang.org/x/image/bmp"
+)
+
+// ImageExtensions lists the file types read as faces
+var ImageExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".bmp"}
+
+// IsImageFile reports whether a file name has a supported image extension
+func IsImageFile(filename string) bool {
+	return slices.Contains(ImageExtensions, strings.ToLower(path.Ext(filename)))
+}
+
+// ImageInfo describes a face of the pool
+type ImageInfo struct {
+	File   string   // relative to the image root, with extension, ex: African/face.png
+	Path   FilePath // path the face is mapped as, ex: African/face
+	Format string   // format of the content, ex: png
+	Width  int
+	Height int
+	Tags   ImageTags // traits read from the metadata sidecars
+}
+
+// PoolIssue is a file of the image root left out of the pool
+type PoolIssue struct {
+	File   string // relative to the image root, with extension
+	Reason string
+}
+
+func (issue PoolIssue) String() string {
+	return fmt.Sprintf("%s: %s", issue.File, issue.Reason)
+}
+
+// PoolReport is what reading an image root found
+type PoolReport struct {
+	Images     []ImageInfo
+	Ignored    []string    // files without an image extension, ex: Thumbs.db, sidecars excepted
+	Invalid    []PoolIssue // images whose header cannot be decoded
+	Collisions []PoolIssue // images mapped as the same path as another, ex: face.jpg and face.png
+	Missing    []Ethnic    // groups without an ethnic folder, left empty
+}
+
+// Valid reports whether no image of the root was left out. Ignored files
+// are not images and missing folders have none, they do not count
+func (report PoolReport) Valid() bool {
+	return len(report.Invalid) == 0 && len(report.Collisions) == 0
+}
+
+func (report PoolReport) String() string {
+	return fmt.Sprintf("%d images, %d files ignored, %d invalid images, %d extension collisions, %d missing ethnic folders",
+		len(report.Images), len(report.Ignored), len(report.Invalid), len(report.Collisions), len(report.Missing))
+}
+
+// Report returns what reading the image root found
+func (images *ImagePool) Report() PoolReport {
+	return images.report
+}
+
+// decodeImageInfo reads the header of an image for its format and size
+func decodeImageInfo(imagePath string) (ImageInfo, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	defer file.Close()
+
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("cannot decode image: %w", err)
+	}
+
+	return ImageInfo{Format: format, Width: config.Width, Height: config.Height}, nil
+}
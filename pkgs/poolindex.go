@@ -0,0 +1,242 @@
+package mapper
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// poolIndexVersion is bumped whenever the index layout changes, older
+// indexes are then rebuilt
+const poolIndexVersion = 3
+
+// racyListing is how close to its modification time a folder must have been
+// listed for the time not to be trusted, coarse file systems may not change
+// it for a file added within the same tick
+const racyListing = 2 * time.Second
+
+// PoolIndex caches what decoding the images of an image root found so that
+// unchanged images are not decoded again. A folder is only listed again when
+// its modification time changes, as adding, removing or renaming a file does,
+// and an image is decoded again when its size or modification time changes
+type PoolIndex struct {
+	Version int                    `json:"version"`
+	Root    string                 `json:"root"`
+	Folders map[string]IndexFolder `json:"folders"` // keyed by path relative to the root, ex: African/part1
+
+	visited map[string]bool // folders read since the index was loaded
+	changed bool
+}
+
+// IndexFolder is a folder of the image root as last listed
+type IndexFolder struct {
+	ModTime int64       `json:"mtime,omitempty"`  // of the folder when it was listed
+	Listed  int64       `json:"listed,omitempty"` // when the folder was listed
+	Entries []IndexFile `json:"entries"`          // in name order, as listed
+}
+
+// IndexFile is a file or subfolder of the image root as last decoded
+type IndexFile struct {
+	Name    string     `json:"name"`
+	Folder  bool       `json:"folder,omitempty"`
+	Size    int64      `json:"size,omitempty"`
+	ModTime int64      `json:"mtime,omitempty"`
+	Format  string     `json:"format,omitempty"` // empty for files that are not images
+	Width   int        `json:"width,omitempty"`
+	Height  int        `json:"height,omitempty"`
+	Invalid string     `json:"invalid,omitempty"` // why the image cannot be decoded
+	Hash    *ImageHash `json:"hash,omitempty"`    // perceptual hash, once computed
+}
+
+// NewPoolIndex returns an empty index of an image root
+func NewPoolIndex(imageRootPath string) *PoolIndex {
+	return &PoolIndex{
+		Version: poolIndexVersion,
+		Root:    imageRootPath,
+		Folders: make(map[string]IndexFolder),
+		visited: make(map[string]bool),
+	}
+}
+
+// LoadPoolIndex reads the index of an image root. A missing, unreadable or
+// outdated index, or one of another root, gives an empty index as the index
+// is only a cache
+func LoadPoolIndex(indexPath string, imageRootPath string) *PoolIndex {
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return NewPoolIndex(imageRootPath)
+	}
+
+	index := NewPoolIndex(imageRootPath)
+	if err := json.Unmarshal(data, index); err != nil || index.Version != poolIndexVersion || index.Root != imageRootPath || index.Folders == nil {
+		return NewPoolIndex(imageRootPath)
+	}
+
+	return index
+}
+
+// Save writes the index when it changed since it was loaded. Folders that
+// were not read, such as deleted ones, are dropped
+func (index *PoolIndex) Save(indexPath string) error {
+	for folder := range index.Folders {
+		if !index.visited[folder] {
+			delete(index.Folders, folder)
+			index.changed = true
+		}
+	}
+	if !index.changed {
+		return nil
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0755); err != nil {
+		return err
+	}
+
+	// written aside first so that a concurrent reader never sees half an index
+	tempPath := indexPath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, indexPath); err != nil {
+		return err
+	}
+
+	index.changed = false
+	return nil
+}
+
+// folder lists a folder relative to the image root, reusing the entries of
+// the files unchanged since it was indexed. A folder unchanged since it was
+// indexed is not listed again, its files are only checked
+func (index *PoolIndex) folder(dir string) (IndexFolder, error) {
+	folderPath := filepath.Join(index.Root, filepath.FromSlash(dir))
+
+	// the time is taken before listing, a file added meanwhile changes it
+	// again and the folder is listed on the next read
+	listed := time.Now().UnixNano()
+	folderInfo, err := os.Stat(folderPath)
+	if err != nil {
+		return IndexFolder{}, err
+	}
+	modTime := folderInfo.ModTime().UnixNano()
+
+	indexed, isKnown := index.Folders[dir]
+	if isKnown && indexed.ModTime == modTime && indexed.Listed-modTime > int64(racyListing) {
+		if folder, unlisted := index.checkFolder(dir, indexed); unlisted {
+			index.visited[dir] = true
+			return folder, nil
+		}
+	}
+
+	entries, err := os.ReadDir(folderPath)
+	if err != nil {
+		return IndexFolder{}, err
+	}
+	index.visited[dir] = true
+
+	previous := make(map[string]IndexFile)
+	for _, file := range indexed.Entries {
+		previous[file.Name] = file
+	}
+
+	folder := IndexFolder{ModTime: modTime, Listed: listed, Entries: make([]IndexFile, 0, len(entries))}
+	for _, entry := range entries {
+		file := IndexFile{Name: entry.Name(), Folder: entry.IsDir()}
+		if !file.Folder {
+			entryInfo, err := entry.Info()
+			if err != nil {
+				return IndexFolder{}, err
+			}
+			file.Size, file.ModTime = entryInfo.Size(), entryInfo.ModTime().UnixNano()
+		}
+		folder.Entries = append(folder.Entries, index.indexFile(folderPath, file, previous))
+	}
+
+	index.Folders[dir] = folder
+	index.changed = true
+	return folder, nil
+}
+
+// checkFolder checks the files of a folder that is not listed again,
+// decoding those changed in place. It reports false when a file is gone and
+// the folder must be listed after all
+func (index *PoolIndex) checkFolder(dir string, indexed IndexFolder) (IndexFolder, bool) {
+	folderPath := filepath.Join(index.Root, filepath.FromSlash(dir))
+
+	previous := make(map[string]IndexFile, len(indexed.Entries))
+	folder := IndexFolder{ModTime: indexed.ModTime, Listed: indexed.Listed, Entries: make([]IndexFile, 0, len(indexed.Entries))}
+	changed := false
+	for _, old := range indexed.Entries {
+		if old.Folder {
+			folder.Entries = append(folder.Entries, old)
+			continue
+		}
+
+		fileInfo, err := os.Stat(filepath.Join(folderPath, old.Name))
+		if err != nil || fileInfo.IsDir() {
+			return IndexFolder{}, false
+		}
+		previous[old.Name] = old
+
+		file := IndexFile{Name: old.Name, Size: fileInfo.Size(), ModTime: fileInfo.ModTime().UnixNano()}
+		file = index.indexFile(folderPath, file, previous)
+		changed = changed || file.Size != old.Size || file.ModTime != old.ModTime
+		folder.Entries = append(folder.Entries, file)
+	}
+
+	if changed {
+		index.Folders[dir] = folder
+		index.changed = true
+	}
+	return index.Folders[dir], true
+}
+
+// indexFile returns the entry of a listed file, the previous one when its
+// size and modification time are unchanged, otherwise the file decoded again
+func (index *PoolIndex) indexFile(folderPath string, file IndexFile, previous map[string]IndexFile) IndexFile {
+	old, isKnown := previous[file.Name]
+	if isKnown && old.Folder == file.Folder && old.Size == file.Size && old.ModTime == file.ModTime {
+		return old
+	}
+
+	if !file.Folder && IsImageFile(file.Name) {
+		info, err := decodeImageInfo(filepath.Join(folderPath, file.Name))
+		if err != nil {
+			file.Invalid = err.Error()
+		}
+		file.Format, file.Width, file.Height = info.Format, info.Width, info.Height
+	}
+	return file
+}
+
+// hash returns the perceptual hash of an image relative to the image root,
+// computing it when unknown and caching it when the image was indexed
+func (index *PoolIndex) hash(file string) (ImageHash, error) {
+	dir, name := path.Split(file)
+	folder := index.Folders[path.Clean(dir)]
+	for i, entry := range folder.Entries {
+		if entry.Folder || entry.Name != name {
+			continue
+		}
+		if entry.Hash != nil {
+			return *entry.Hash, nil
+		}
+
+		hash, err := PerceptualHash(filepath.Join(index.Root, filepath.FromSlash(file)))
+		if err != nil {
+			return 0, err
+		}
+		folder.Entries[i].Hash = &hash
+		index.changed = true
+		return hash, nil
+	}
+
+	return PerceptualHash(filepath.Join(index.Root, filepath.FromSlash(file)))
+}
@@ -0,0 +1,161 @@
+package mapper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPoolIndex_Refresh(t *testing.T) {
+	root := setupImageRoot(t, "African/a.png", "African/part1/b.png", "Asian/c.png")
+	indexPath := filepath.Join(t.TempDir(), "index", "pool.json")
+	options := PoolOptions{IndexPath: indexPath}
+
+	if _, err := NewImagePoolWithOptions(root, options); err != nil {
+		t.Fatalf("failed to read pool: %v", err)
+	}
+	index := LoadPoolIndex(indexPath, root)
+	if len(index.Folders["African"].Entries) != 2 || len(index.Folders["African/part1"].Entries) != 1 {
+		t.Fatalf("expected the African folders to be indexed, got %v", index.Folders)
+	}
+
+	// an unchanged image is taken from the index rather than decoded again
+	entries := index.Folders["Asian"].Entries
+	entries[0].Width = 99
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatalf("failed to marshal index: %v", err)
+	}
+	if err := os.WriteFile(indexPath, data, 0644); err != nil {
+		t.Fatalf("failed to write index: %v", err)
+	}
+
+	// added images and removed folders are picked up
+	if err := os.WriteFile(filepath.Join(root, "Asian", "d.png"), pngBytes(t, 2, 3), 0644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(root, "African", "part1")); err != nil {
+		t.Fatalf("failed to remove folder: %v", err)
+	}
+
+	pool, err := NewImagePoolWithOptions(root, options)
+	if err != nil {
+		t.Fatalf("failed to read pool: %v", err)
+	}
+
+	widths := make(map[string]int)
+	for _, info := range pool.Report().Images {
+		widths[info.File] = info.Width
+	}
+	if len(widths) != 3 {
+		t.Fatalf("expected 3 images, got %v", widths)
+	}
+	if widths["Asian/c.png"] != 99 {
+		t.Fatalf("expected the indexed width 99 for Asian/c.png, got %d", widths["Asian/c.png"])
+	}
+	if widths["Asian/d.png"] != 2 {
+		t.Fatalf("expected the decoded width 2 for Asian/d.png, got %d", widths["Asian/d.png"])
+	}
+
+	index = LoadPoolIndex(indexPath, root)
+	if _, found := index.Folders["African/part1"]; found {
+		t.Fatalf("expected the removed folder to be dropped from the index")
+	}
+	if len(index.Folders["Asian"].Entries) != 2 {
+		t.Fatalf("expected 2 indexed Asian entries, got %v", index.Folders["Asian"].Entries)
+	}
+}
+
+func TestPoolIndex_UnchangedFolders(t *testing.T) {
+	root := setupImageRoot(t, "Asian/c.png")
+	indexPath := filepath.Join(t.TempDir(), "pool.json")
+	options := PoolOptions{IndexPath: indexPath}
+
+	// folders changed just before they are listed are always listed again
+	asian := filepath.Join(root, "Asian")
+	earlier := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(asian, earlier, earlier); err != nil {
+		t.Fatalf("failed to touch folder: %v", err)
+	}
+	if _, err := NewImagePoolWithOptions(root, options); err != nil {
+		t.Fatalf("failed to read pool: %v", err)
+	}
+
+	widths := func() map[string]int {
+		t.Helper()
+		pool, err := NewImagePoolWithOptions(root, options)
+		if err != nil {
+			t.Fatalf("failed to read pool: %v", err)
+		}
+		widths := make(map[string]int)
+		for _, info := range pool.Report().Images {
+			widths[info.File] = info.Width
+		}
+		return widths
+	}
+
+	// a file added without changing the folder's time shows that the folder
+	// was not listed again, the image overwritten in place is still decoded
+	if err := os.WriteFile(filepath.Join(asian, "d.png"), pngBytes(t, 1, 1), 0644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(asian, "c.png"), pngBytes(t, 5, 4), 0644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	if err := os.Chtimes(asian, earlier, earlier); err != nil {
+		t.Fatalf("failed to touch folder: %v", err)
+	}
+	if got := widths(); len(got) != 1 || got["Asian/c.png"] != 5 {
+		t.Fatalf("expected only the overwritten Asian/c.png with width 5, got %v", got)
+	}
+
+	// a folder whose time changed is listed again
+	later := earlier.Add(time.Minute)
+	if err := os.Chtimes(asian, later, later); err != nil {
+		t.Fatalf("failed to touch folder: %v", err)
+	}
+	if got := widths(); len(got) != 2 {
+		t.Fatalf("expected the folder to be listed again, got %v", got)
+	}
+}
+
+func TestPoolIndex_Hashes(t *testing.T) {
+	root := setupImageRoot(t)
+	writeGradient(t, root, "African/a.png", 48, false)
+	writeGradient(t, root, "Asian/a-copy.png", 96, false)
+	indexPath := filepath.Join(t.TempDir(), "pool.json")
+
+	pool, err := NewImagePoolWithOptions(root, PoolOptions{IndexPath: indexPath})
+	if err != nil {
+		t.Fatalf("failed to read pool: %v", err)
+	}
+	groups, _, err := pool.FindDuplicates(DefaultDuplicateThreshold)
+	if err != nil {
+		t.Fatalf("failed to find duplicates: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 duplicate group, got %d", len(groups))
+	}
+
+	index := LoadPoolIndex(indexPath, root)
+	for _, folder := range []string{"African", "Asian"} {
+		if entries := index.Folders[folder].Entries; len(entries) != 1 || entries[0].Hash == nil {
+			t.Fatalf("expected the hash of the %s image to be indexed, got %v", folder, entries)
+		}
+	}
+}
+
+func TestLoadPoolIndex_OtherRoot(t *testing.T) {
+	root := setupImageRoot(t, "African/a.png")
+	indexPath := filepath.Join(t.TempDir(), "pool.json")
+
+	if _, err := NewImagePoolWithOptions(root, PoolOptions{IndexPath: indexPath}); err != nil {
+		t.Fatalf("failed to read pool: %v", err)
+	}
+
+	if index := LoadPoolIndex(indexPath, t.TempDir()); len(index.Folders) != 0 {
+		t.Fatalf("expected an empty index for another root, got %d folders", len(index.Folders))
+	}
+}
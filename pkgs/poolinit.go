@@ -0,0 +1,112 @@
+package mapper
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InitPool scaffolds a face pack: the image root with a folder for every
+// built-in and user-defined ethnic group, and a default config.xml. Folders
+// and a config.xml already there are kept. The folders created are returned
+func InitPool(imageRootPath string, groups *EthnicGroups) ([]string, error) {
+	created := []string{}
+	for _, ethnic := range groups.All() {
+		folder := groups.Folder(ethnic)
+		folderPath := filepath.Join(imageRootPath, filepath.FromSlash(folder))
+
+		if _, err := os.Stat(folderPath); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(folderPath, 0755); err != nil {
+			return created, fmt.Errorf("failed to create the %s folder: %w", folder, err)
+		}
+		created = append(created, folder)
+	}
+
+	return created, GenerateConfigXML(imageRootPath)
+}
+
+// manifestEthnic returns the ethnic of a manifest row, given by its name or
+// by its folder without case
+func manifestEthnic(groups *EthnicGroups, value string) (Ethnic, bool) {
+	value = strings.TrimSpace(value)
+	for _, ethnic := range groups.All() {
+		if strings.EqualFold(string(ethnic), value) || strings.EqualFold(groups.Folder(ethnic), value) {
+			return ethnic, true
+		}
+	}
+	return "", false
+}
+
+// SortImages moves the images of a flat folder into the ethnic folders of the
+// image root as listed by a CSV manifest of "file,ethnic" rows, ex:
+// "face_0012.png,Central European". A first row starting with "file" is a
+// header. Rows that cannot be sorted are returned as issues and left in place,
+// images already in their ethnic folder are never overwritten
+func SortImages(sourcePath string, imageRootPath string, manifestPath string, groups *EthnicGroups) (int, []PoolIssue, error) {
+	manifest, err := os.Open(manifestPath)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot read manifest: %w", err)
+	}
+	defer manifest.Close()
+
+	reader := csv.NewReader(manifest)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	moved := 0
+	issues := []PoolIssue{}
+	for first := true; ; first = false {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return moved, issues, fmt.Errorf("cannot read manifest: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if first && strings.EqualFold(strings.TrimSpace(row[0]), "file") {
+			continue
+		}
+
+		if len(row) < 2 {
+			issues = append(issues, PoolIssue{File: row[0], Reason: fmt.Sprintf("line %d: expected a file and an ethnic group", line)})
+			continue
+		}
+		file := strings.TrimSpace(row[0])
+
+		ethnic, found := manifestEthnic(groups, row[1])
+		switch {
+		case !IsImageFile(file):
+			issues = append(issues, PoolIssue{File: file, Reason: fmt.Sprintf("line %d: not an image", line)})
+			continue
+		case !found:
+			issues = append(issues, PoolIssue{File: file, Reason: fmt.Sprintf(`line %d: "%s" is not an ethnic group`, line, strings.TrimSpace(row[1]))})
+			continue
+		}
+
+		source := filepath.Join(sourcePath, filepath.FromSlash(file))
+		target := filepath.Join(imageRootPath, filepath.FromSlash(groups.Folder(ethnic)), filepath.Base(source))
+
+		if _, err := os.Stat(target); err == nil {
+			issues = append(issues, PoolIssue{File: file, Reason: fmt.Sprintf("line %d: %s already has an image of that name", line, groups.Folder(ethnic))})
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			issues = append(issues, PoolIssue{File: file, Reason: fmt.Sprintf("line %d: %v", line, err)})
+			continue
+		}
+		if err := os.Rename(source, target); err != nil {
+			issues = append(issues, PoolIssue{File: file, Reason: fmt.Sprintf("line %d: %v", line, err)})
+			continue
+		}
+		moved++
+	}
+
+	return moved, issues, nil
+}
@@ -0,0 +1,70 @@
+package mapper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitPool(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "faces")
+
+	created, err := InitPool(root, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(created) != len(Ethnicities) {
+		t.Fatalf("expected %d folders, got %v", len(Ethnicities), created)
+	}
+	for _, folder := range []string{"Central European", "South American", "config.xml"} {
+		if _, err := os.Stat(filepath.Join(root, folder)); err != nil {
+			t.Fatalf("expected %s to be created, got %v", folder, err)
+		}
+	}
+
+	pool, err := NewImagePool(root)
+	if err != nil || len(pool.Report().Missing) != 0 {
+		t.Fatalf("expected a pool without missing folders, got %v", err)
+	}
+
+	// a second run keeps what is there
+	created, err = InitPool(root, nil)
+	if err != nil || len(created) != 0 {
+		t.Fatalf("expected no folder to be created, got %v %v", created, err)
+	}
+}
+
+func TestSortImages(t *testing.T) {
+	root := setupImageRoot(t, "SpanMed/taken.png")
+	source := t.TempDir()
+	for _, file := range []string{"a.png", "b.jpg", "taken.png", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(source, file), pngBytes(t, 1, 1), 0644); err != nil {
+			t.Fatalf("failed to write image: %v", err)
+		}
+	}
+
+	manifest := filepath.Join(t.TempDir(), "faces.csv")
+	content := "file,ethnic\na.png,Central European\n b.jpg , eeca\ntaken.png,SpanMed\nnotes.txt,African\nc.png,Martian\nmissing.png,African\nlonely.png\n"
+	if err := os.WriteFile(manifest, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	moved, issues, err := SortImages(source, root, manifest, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if moved != 2 || len(issues) != 5 {
+		t.Fatalf("expected 2 moved images and 5 issues, got %d %v", moved, issues)
+	}
+	for _, file := range []string{"Central European/a.png", "EECA/b.jpg"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(file))); err != nil {
+			t.Fatalf("expected %s to be sorted, got %v", file, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(source, "taken.png")); err != nil {
+		t.Fatalf("expected the colliding image to be left in place, got %v", err)
+	}
+	if issues[0].Reason != "line 4: SpanMed already has an image of that name" {
+		t.Fatalf("expected the collision on line 4, got %v", issues[0])
+	}
+}
@@ -0,0 +1,49 @@
+package mapper
+
+// nationRegions groups nation codes by geographic region, including codes
+// missing from the built-in table such as former nations. The groups of the
+// mapped nations of a region suggest a group for an unmapped one
+var nationRegions = map[string][]string{
+	"Iberia":            {"AND", "BAS", "CAT", "ESP", "GIB", "POR"},
+	"Italian Peninsula": {"ITA", "MLT", "MON", "SMR", "VAT"},
+	"Balkans":           {"ALB", "BIH", "BUL", "CRO", "GRE", "KOS", "KVX", "MKD", "MNE", "SCG", "SRB", "SVN", "XKX", "YUG"},
+	"British Isles":     {"ENG", "GBR", "GGY", "IMN", "IRL", "JEY", "NIR", "SCO", "WAL"},
+	"Western Europe":    {"AUT", "BEL", "FRA", "GDR", "GER", "LIE", "LUX", "NED", "SUI"},
+	"Central Europe":    {"CZE", "HUN", "POL", "SVK", "TCH"},
+	"Nordic Countries":  {"AXL", "DEN", "FIN", "FRO", "GRL", "ISL", "NOR", "SWE"},
+	"Baltic States":     {"EST", "LTU", "LVA"},
+	"Eastern Europe":    {"BLR", "MDA", "ROU", "RUS", "UKR", "URS"},
+	"Caucasus":          {"ARM", "AZE", "GEO"},
+	"Central Asia":      {"KAZ", "KGZ", "TJK", "TKM", "UZB"},
+	"Levant":            {"CYP", "ISR", "JOR", "LBN", "LIB", "PAL", "PLE", "SYR", "TUR"},
+	"Arabian Peninsula": {"BHR", "IRQ", "KSA", "KUW", "OMA", "QAT", "UAE", "YEM"},
+	"South Asia":        {"AFG", "BAN", "BHU", "IND", "IRN", "MDV", "NEP", "PAK", "SRI"},
+	"North Africa":      {"ALG", "EGY", "LBY", "MAR", "SAH", "SUD", "TUN"},
+	"West Africa":       {"BEN", "BFA", "CIV", "CPV", "GAM", "GHA", "GNB", "GUI", "LBR", "MLI", "MTN", "NGA", "NIG", "SEN", "SLE", "TOG"},
+	"Central Africa":    {"ANG", "CGO", "CHA", "CMR", "COD", "CTA", "EQG", "GAB", "STP", "ZAI"},
+	"East Africa":       {"BDI", "DJI", "ERI", "ETH", "KEN", "RWA", "SDN", "SOM", "SSD", "TAN", "UGA", "ZAN"},
+	"Southern Africa":   {"BOT", "ESW", "LES", "MOZ", "MWI", "NAM", "RSA", "SWZ", "ZAM", "ZIM"},
+	"Indian Ocean":      {"COM", "MAD", "MAY", "MRI", "REU", "SEY"},
+	"East Asia":         {"CHN", "HKG", "JPN", "KOR", "MAC", "MGL", "MNG", "PRK", "TPE"},
+	"Southeast Asia":    {"BRU", "CAM", "IDN", "LAO", "MAS", "MYA", "PHI", "SGP", "SIN", "THA", "TLS", "VIE"},
+	"Australasia":       {"AUS", "NZL"},
+	"Pacific Islands":   {"ASA", "COK", "FIJ", "FSM", "GUM", "KIR", "MHL", "MNP", "NCL", "NIU", "NMI", "NRU", "PLW", "PNG", "SAM", "SOL", "TAH", "TGA", "TUV", "VAN", "WFI"},
+	"North America":     {"CAN", "SPM", "USA"},
+	"Central America":   {"BLZ", "CRC", "GUA", "HON", "MEX", "NCA", "PAN", "SLV"},
+	"Caribbean":         {"AIA", "ANT", "ARU", "ATG", "BAH", "BER", "BLM", "BOE", "BRB", "CAY", "CUB", "CUW", "DMA", "DOM", "GLP", "GRN", "HAI", "JAM", "LCA", "MSR", "MTQ", "PUR", "SKN", "SMA", "SMN", "SXM", "TCA", "TRI", "VGB", "VIN", "VIR"},
+	"South America":     {"ARG", "BOL", "BRA", "CHI", "COL", "ECU", "GUF", "GUY", "PAR", "PER", "SUR", "URU", "VEN"},
+}
+
+// nationRegion returns the region of a nation code and the other nations of
+// that region, empty when the code is in no region
+func nationRegion(nation string) (string, []string) {
+	for region, nations := range nationRegions {
+		for i, code := range nations {
+			if code == nation {
+				others := append(append([]string{}, nations[:i]...), nations[i+1:]...)
+				return region, others
+			}
+		}
+	}
+	return "", nil
+}
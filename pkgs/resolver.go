@@ -0,0 +1,134 @@
+package mapper
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// UnknownNationPolicy decides what happens to a player whose first
+// nationality is not in the nation table
+type UnknownNationPolicy string
+
+const (
+	UnknownNationStrict       UnknownNationPolicy = "strict"        // the player cannot be resolved
+	UnknownNationUseSecond    UnknownNationPolicy = "use-second"    // the second nationality is used instead
+	UnknownNationDefaultGroup UnknownNationPolicy = "default-group" // a configured ethnic is used instead
+)
+
+// UnknownNationPolicies lists the policies in the order they are offered
+var UnknownNationPolicies = []UnknownNationPolicy{UnknownNationStrict, UnknownNationUseSecond, UnknownNationDefaultGroup}
+
+// Resolver decides players' ethnics from its own copy of the nation table,
+// the mapping overrides of a profile and a rule table. Every run builds its
+// own resolver, so overrides never leak from one profile or run to the next
+type Resolver struct {
+	nations    map[string]Ethnic        // ex: FRA => Central European
+	aliases    map[string]string        // ex: XKX => KOS
+	weights    map[string]EthnicWeights // weighted overrides, keyed by nation ("FRA") or nation and ethnic value ("FRA:0")
+	overridden map[string]bool          // nations whose group was set by a mapping override
+	rules      []EthnicRule
+	groups     *EthnicGroups // built-in and user-defined groups, nil for the built-in ones
+
+	unknownPolicy UnknownNationPolicy
+	unknownEthnic Ethnic // ethnic of the default-group policy
+}
+
+// NewResolver returns a resolver holding a copy of the built-in nation table
+// of the newest FM version and the default rule table
+func NewResolver() *Resolver {
+	table, _ := BuiltinNationTable(NationTableVersions[0])
+	return NewTableResolver(table)
+}
+
+// NewTableResolver returns a resolver holding a copy of the given nation
+// table and the default rule table
+func NewTableResolver(table NationTable) *Resolver {
+	return &Resolver{
+		nations: maps.Clone(table.Nations),
+		aliases: maps.Clone(table.Aliases),
+		weights: make(map[string]EthnicWeights),
+		rules:   DefaultEthnicRules,
+
+		overridden: make(map[string]bool),
+
+		unknownPolicy: UnknownNationStrict,
+	}
+}
+
+// canonical returns the code a nation code resolves to through the aliases
+func (r *Resolver) canonical(nation string) string {
+	if alias, ok := r.aliases[nation]; ok {
+		return alias
+	}
+	return nation
+}
+
+// SetEthnicGroups sets the ethnic groups of the run. Overrides, rules and
+// policies are validated against them, so they are set first
+func (r *Resolver) SetEthnicGroups(groups *EthnicGroups) {
+	r.groups = groups
+}
+
+// Groups returns the ethnic groups of the resolver
+func (r *Resolver) Groups() *EthnicGroups {
+	return r.groups
+}
+
+// SetRules replaces the rule table of the resolver
+func (r *Resolver) SetRules(rules []EthnicRule) {
+	r.rules = rules
+}
+
+// SetUnknownNationPolicy sets how players with an unknown first nationality
+// are resolved. The ethnic is only used by the default-group policy
+func (r *Resolver) SetUnknownNationPolicy(policy UnknownNationPolicy, ethnic Ethnic) error {
+	switch policy {
+	case "", UnknownNationStrict:
+		policy = UnknownNationStrict
+	case UnknownNationUseSecond:
+	case UnknownNationDefaultGroup:
+		if !r.groups.IsValid(string(ethnic)) {
+			return fmt.Errorf(`ethnic value "%s" is not valid ethnic for the default-group policy`, ethnic)
+		}
+	default:
+		return fmt.Errorf(`unknown nationality policy "%s", expected strict, use-second or default-group`, policy)
+	}
+
+	r.unknownPolicy = policy
+	r.unknownEthnic = ethnic
+	return nil
+}
+
+// Rules returns the rule table of the resolver
+func (r *Resolver) Rules() []EthnicRule {
+	return r.rules
+}
+
+// Trace decides the ethnic of a nationality pair and ethnic value as a run
+// would and records each step taken
+func (r *Resolver) Trace(nationality1, nationality2 string, ethnicValue int) (Ethnic, EthnicTrace, error) {
+	return traceEthnic(r, nationality1, nationality2, ethnicValue)
+}
+
+// Nation returns the ethnic a nation maps to, the dominant one for weighted nations
+func (r *Resolver) Nation(nation string) (Ethnic, bool) {
+	ethnic, ok := r.nations[r.canonical(nation)]
+	return ethnic, ok
+}
+
+// Weights returns the weighted override of a nation ("FRA") or of a nation and
+// ethnic value pair ("FRA:0")
+func (r *Resolver) Weights(key string) (EthnicWeights, bool) {
+	weights, ok := r.weights[r.canonicalKey(key)]
+	return weights, ok
+}
+
+// canonicalKey resolves the nation of an override key through the aliases
+func (r *Resolver) canonicalKey(key string) string {
+	nation, value, isPair := strings.Cut(key, ":")
+	if !isPair {
+		return r.canonical(nation)
+	}
+	return r.canonical(nation) + ":" + value
+}
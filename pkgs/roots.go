@@ -0,0 +1,125 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ImageRoot is an image folder merged into the pool next to the main image
+// root, such as a smaller premium face pack kept apart from the base pack
+type ImageRoot struct {
+	Path     string `toml:"path"`
+	Priority int    `toml:"priority,omitempty"` // roots with a higher priority are drawn from first, the main root has priority 0
+}
+
+// relativeRoot returns the path of an additional root relative to the main
+// image root. Images of the root are qualified with it in the pool, ex:
+// ../premium/African/face, so that they stay apart from the main root's
+// and resolve against it like any other image
+func relativeRoot(imageRootPath string, root string) (string, error) {
+	mainPath, err := filepath.Abs(imageRootPath)
+	if err != nil {
+		return "", err
+	}
+	rootPath, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(mainPath, rootPath)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return "", errors.New("it is the main image root")
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Roots returns the additional image roots of the pool relative to the main
+// image root, as their images are qualified, ex: ../premium. A nil pool has
+// none
+func (images *ImagePool) Roots() []string {
+	if images == nil {
+		return nil
+	}
+	return images.roots
+}
+
+// rootImage returns an image relative to its own root, stripping the root
+// qualifier of images of additional roots, ex: ../premium/African/face =>
+// African/face
+func (options AssignOptions) rootImage(image FilePath) FilePath {
+	imagePath := filepath.ToSlash(string(image))
+	for _, root := range options.Roots {
+		if strings.HasPrefix(imagePath, root+"/") {
+			return FilePath(strings.TrimPrefix(imagePath, root+"/"))
+		}
+	}
+	return FilePath(imagePath)
+}
+
+// highestPriority keeps the candidates of the highest priority among those
+// no player has yet, so that the images of a higher root are drawn first
+// without taking every pick once duplicates are allowed. Candidates sharing a
+// priority, or all given out already, are kept as they are
+func (images *ImagePool) highestPriority(ethnicPool []PoolImage, candidates []int) []int {
+	unused := make([]int, 0, len(candidates))
+	shared := true
+	for _, index := range candidates {
+		shared = shared && ethnicPool[index].Priority == ethnicPool[candidates[0]].Priority
+		if images.usage[ethnicPool[index].Path] == 0 {
+			unused = append(unused, index)
+		}
+	}
+	if shared || len(unused) == 0 {
+		return candidates
+	}
+
+	highest := make([]int, 0, len(unused))
+	for _, index := range unused {
+		switch {
+		case len(highest) == 0 || ethnicPool[index].Priority > ethnicPool[highest[0]].Priority:
+			highest = append(highest[:0], index)
+		case ethnicPool[index].Priority == ethnicPool[highest[0]].Priority:
+			highest = append(highest, index)
+		}
+	}
+	return highest
+}
+
+// readRoot reads the ethnic folders of an additional root into the pool.
+// Additional roots only need the folders they have faces for
+func (reader *poolReader) readRoot(pool map[Ethnic][]PoolImage, root ImageRoot) (string, error) {
+	qualifier, err := relativeRoot(reader.root, root.Path)
+	if err != nil {
+		return "", fmt.Errorf("cannot add image root %s: %w", root.Path, err)
+	}
+
+	reader.rootDir = qualifier
+	defer func() { reader.rootDir = "" }()
+
+	groups := reader.options.Groups
+	for _, ethnic := range groups.All() {
+		folder := qualifier + "/" + groups.Folder(ethnic)
+		if _, err := os.Stat(filepath.Join(reader.root, filepath.FromSlash(folder))); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		rootPool, err := reader.readFolder(folder, folderTraits{}, 0)
+		if err != nil {
+			return "", errors.Join(fmt.Errorf("cannot get ethnic folder %s of image root %s", groups.Folder(ethnic), root.Path), err)
+		}
+
+		for i := range rootPool {
+			rootPool[i].Priority = root.Priority
+		}
+		pool[ethnic] = append(pool[ethnic], rootPool...)
+	}
+
+	return qualifier, nil
+}
@@ -0,0 +1,103 @@
+package mapper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAssignImages_Roots(t *testing.T) {
+	root := setupImageRoot(t, "African/a.png")
+
+	// the premium pack only has an African folder
+	premium := filepath.Join(filepath.Dir(root), "premium")
+	if err := os.MkdirAll(filepath.Join(premium, "African"), 0755); err != nil {
+		t.Fatalf("failed to create folder: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(premium, "African", "p.png"), pngBytes(t, 1, 1), 0644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+
+	pool, err := NewImagePoolWithOptions(root, PoolOptions{Roots: []ImageRoot{{Path: premium, Priority: 1}}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if roots := pool.Roots(); len(roots) != 1 || roots[0] != "../premium" {
+		t.Fatalf("expected the root ../premium, got %v", roots)
+	}
+
+	// the premium image is drawn first and mapped relative to the mapping
+	// file, which sits next to both roots
+	prefix := RelativeImagePrefix(filepath.Join(filepath.Dir(root), "config.xml"), root)
+	if prefix != filepath.Base(root) {
+		t.Fatalf("expected the prefix %s, got %s", filepath.Base(root), prefix)
+	}
+	faceA := FilePath(filepath.Join(prefix, "African", "a"))
+
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{}}
+	players := []Player{{ID: "1", Ethnic: African}, {ID: "2", Ethnic: African}}
+	options := AssignOptions{ImagePrefix: prefix, Roots: pool.Roots()}
+
+	AssignImages(mapping, pool, players, options)
+	if mapping.idImageMap["1"] != FilePath(filepath.Join("premium", "African", "p")) || mapping.idImageMap["2"] != faceA {
+		t.Fatalf("expected premium/African/p then %s, got %v", faceA, mapping.idImageMap)
+	}
+
+	// the premium image stays taken in a later run
+	pool, err = NewImagePoolWithOptions(root, PoolOptions{Roots: []ImageRoot{{Path: premium, Priority: 1}}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	mapping = &Mapping{idImageMap: map[PlayerID]FilePath{"1": FilePath(filepath.Join("premium", "African", "p"))}}
+
+	result := AssignImages(mapping, pool, []Player{{ID: "3", Ethnic: African}}, options)
+	if mapping.idImageMap["3"] != faceA || result.Assigned != 1 {
+		t.Fatalf("expected player 3 to get %s, got %v %+v", faceA, mapping.idImageMap, result)
+	}
+
+	usage := UsageReport(mapping, pool, options)
+	if len(usage) != 1 || usage[0].Ethnic != African || usage[0].Uses() != 2 {
+		t.Fatalf("expected both images under African, got %+v", usage)
+	}
+}
+
+func TestNewImagePoolWithOptions_SameRoot(t *testing.T) {
+	root := setupImageRoot(t)
+
+	if _, err := NewImagePoolWithOptions(root, PoolOptions{Roots: []ImageRoot{{Path: root}}}); err == nil {
+		t.Fatalf("expected an error for the main root given again")
+	}
+}
+
+func TestAssignImages_RootPriorityWithDuplicates(t *testing.T) {
+	root := setupImageRoot(t, "African/a.png", "African/b.png")
+
+	premium := filepath.Join(filepath.Dir(root), "premium")
+	if err := os.MkdirAll(filepath.Join(premium, "African"), 0755); err != nil {
+		t.Fatalf("failed to create folder: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(premium, "African", "p.png"), pngBytes(t, 1, 1), 0644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+
+	pool, err := NewImagePoolWithOptions(root, PoolOptions{Roots: []ImageRoot{{Path: premium, Priority: 1}}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// the premium image is drawn first, not for every player
+	mapping := &Mapping{idImageMap: map[PlayerID]FilePath{}}
+	players := []Player{{ID: "1", Ethnic: African}, {ID: "2", Ethnic: African}, {ID: "3", Ethnic: African}}
+	AssignImages(mapping, pool, players, AssignOptions{AllowDuplicate: true, Roots: pool.Roots()})
+
+	if mapping.idImageMap["1"] != "../premium/African/p" {
+		t.Fatalf("expected player 1 to get the premium image, got %v", mapping.idImageMap)
+	}
+	uses := make(map[FilePath]int)
+	for _, image := range mapping.AssignedImages() {
+		uses[image]++
+	}
+	if len(uses) != 3 {
+		t.Fatalf("expected every image to be used once, got %v", uses)
+	}
+}
@@ -0,0 +1,182 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// RuleResultNationality makes a rule return the ethnic of the first
+// nationality, or of the second one when the first is unknown
+const RuleResultNationality = "@nationality"
+
+// EthnicRule decides a player's ethnic from the FM ethnic value and the
+// ethnics both nationalities map to. Rules are evaluated in order and the
+// first one whose conditions hold wins
+type EthnicRule struct {
+	Name   string   `toml:"name,omitempty"`
+	Values []int    `toml:"values"`           // FM ethnic values the rule applies to
+	First  []Ethnic `toml:"first,omitempty"`  // the first nationality must map to one of these
+	Either []Ethnic `toml:"either,omitempty"` // either nationality must map to one of these
+	Result string   `toml:"result"`           // an ethnic or RuleResultNationality
+}
+
+type ethnicRuleFile struct {
+	Rules []EthnicRule `toml:"rule"`
+}
+
+// DefaultEthnicRules reproduces how FM ethnic values have always been combined
+// with the nationalities
+var DefaultEthnicRules = []EthnicRule{
+	{Name: "white, scandinavian nation", Values: []int{0}, Either: []Ethnic{Scandinavian}, Result: string(Scandinavian)},
+	{Name: "white, caucasian nation", Values: []int{0}, Either: []Ethnic{Caucasian}, Result: string(Caucasian)},
+	{Name: "white", Values: []int{0}, Result: string(CentralEuropean)},
+	{
+		Name:   "mediterranean, outside of the mediterranean groups",
+		Values: []int{1},
+		Either: []Ethnic{
+			Scandinavian,
+			SouthEastAsian,
+			CentralEuropean,
+			Caucasian,
+			African,
+			Asian,
+			MiddleEastNorthAfrican,
+			MiddleEastSouthAsian,
+			EasternEuropeanCentralAsian,
+		},
+		Result: string(SouthAmerican),
+	},
+	{Name: "mediterranean", Values: []int{1}, Result: RuleResultNationality},
+	{Name: "north african/middle eastern, south asian nation", Values: []int{2}, Either: []Ethnic{MiddleEastSouthAsian}, Result: string(MiddleEastSouthAsian)},
+	{Name: "north african/middle eastern", Values: []int{2}, Result: string(MiddleEastNorthAfrican)},
+	{Name: "mixed, SAMed nation", Values: []int{7}, First: []Ethnic{SouthAmericanMediterranean}, Result: string(SouthAmericanMediterranean)},
+	{Name: "mixed, south american nation", Values: []int{7}, First: []Ethnic{SouthAmerican}, Result: string(SouthAmerican)},
+	{Name: "black and mixed", Values: []int{3, 6, 7, 8, 9}, Result: string(African)},
+	{Name: "south asian", Values: []int{4}, Result: string(MiddleEastSouthAsian)},
+	{Name: "south east asian", Values: []int{5}, Result: string(SouthEastAsian)},
+	{Name: "east asian, south american nation", Values: []int{10}, First: []Ethnic{SouthAmerican}, Result: string(SouthAmerican)},
+	{Name: "east asian", Values: []int{10}, Result: string(Asian)},
+}
+
+// String describes the rule for logs and traces, ex: rule 3 "white"
+func (rule EthnicRule) String() string {
+	if rule.Name == "" {
+		return fmt.Sprintf("values %v → %s", rule.Values, rule.Result)
+	}
+	return fmt.Sprintf("%q", rule.Name)
+}
+
+// containsKindOf reports whether ethnic is one of the listed ethnics or a
+// user-defined group descending from one of them
+func containsKindOf(groups *EthnicGroups, ethnics []Ethnic, ethnic Ethnic) bool {
+	return slices.ContainsFunc(ethnics, func(target Ethnic) bool {
+		return groups.isKindOf(ethnic, target)
+	})
+}
+
+func (rule EthnicRule) matches(groups *EthnicGroups, ethnic1, ethnic2 Ethnic, ethnicValue int) bool {
+	if !slices.Contains(rule.Values, ethnicValue) {
+		return false
+	}
+	if len(rule.First) > 0 && !containsKindOf(groups, rule.First, ethnic1) {
+		return false
+	}
+	if len(rule.Either) > 0 && !containsKindOf(groups, rule.Either, ethnic1) && !containsKindOf(groups, rule.Either, ethnic2) {
+		return false
+	}
+	return true
+}
+
+// EvaluateEthnicRules returns the ethnic chosen by the first matching rule and
+// the index of that rule. When the result is the parent of a nationality's
+// user-defined group, that more specific group is returned instead
+func EvaluateEthnicRules(groups *EthnicGroups, rules []EthnicRule, ethnic1, ethnic2 Ethnic, ethnicValue int) (Ethnic, int, error) {
+	for index, rule := range rules {
+		if !rule.matches(groups, ethnic1, ethnic2, ethnicValue) {
+			continue
+		}
+
+		if rule.Result != RuleResultNationality {
+			result := Ethnic(rule.Result)
+			for _, ethnic := range []Ethnic{ethnic1, ethnic2} {
+				if groups.isKindOf(ethnic, result) {
+					return ethnic, index, nil
+				}
+			}
+			return result, index, nil
+		}
+		if ethnic1 != "" {
+			return ethnic1, index, nil
+		}
+		return ethnic2, index, nil
+	}
+
+	return "", -1, fmt.Errorf("ethnic value not found: %d", ethnicValue)
+}
+
+// ValidateEthnicRules checks that every rule applies to at least one ethnic
+// value and only references valid ethnics of the groups
+func ValidateEthnicRules(rules []EthnicRule, groups *EthnicGroups) error {
+	ruleErrors := []error{}
+
+	for index, rule := range rules {
+		if len(rule.Values) == 0 {
+			ruleErrors = append(ruleErrors, fmt.Errorf("rule %d %s has no ethnic values", index+1, rule))
+		}
+
+		for _, ethnic := range append(slices.Clone(rule.First), rule.Either...) {
+			if !groups.IsValid(string(ethnic)) {
+				ruleErrors = append(ruleErrors, fmt.Errorf(`rule %d %s references invalid ethnic "%s"`, index+1, rule, ethnic))
+			}
+		}
+
+		if rule.Result != RuleResultNationality && !groups.IsValid(rule.Result) {
+			ruleErrors = append(ruleErrors, fmt.Errorf(`rule %d %s has invalid result "%s"`, index+1, rule, rule.Result))
+		}
+	}
+
+	if len(ruleErrors) > 0 {
+		return errors.Join(ruleErrors...)
+	}
+
+	return nil
+}
+
+// ParseEthnicRules reads a rule table from TOML, one [[rule]] table per rule,
+// referring to the given ethnic groups
+func ParseEthnicRules(data []byte, groups *EthnicGroups) ([]EthnicRule, error) {
+	var ruleFile ethnicRuleFile
+
+	if err := toml.Unmarshal(data, &ruleFile); err != nil {
+		return nil, errors.Join(errors.New("cannot parse ethnic rules"), err)
+	}
+
+	if len(ruleFile.Rules) == 0 {
+		return nil, errors.New("ethnic rules file has no rules")
+	}
+
+	if err := ValidateEthnicRules(ruleFile.Rules, groups); err != nil {
+		return nil, err
+	}
+
+	return ruleFile.Rules, nil
+}
+
+// LoadEthnicRules reads and validates a rule table file
+func LoadEthnicRules(rulesPath string, groups *EthnicGroups) ([]EthnicRule, error) {
+	data, err := os.ReadFile(rulesPath)
+	if err != nil {
+		return nil, errors.Join(errors.New("cannot read ethnic rules file"), err)
+	}
+
+	return ParseEthnicRules(data, groups)
+}
+
+// MarshalEthnicRules writes a rule table in the format read by ParseEthnicRules
+func MarshalEthnicRules(rules []EthnicRule) ([]byte, error) {
+	return toml.Marshal(ethnicRuleFile{Rules: rules})
+}
@@ -0,0 +1,115 @@
+package mapper
+
+import (
+	"strings"
+	"testing"
+)
+
+// legacyEthnic is the hardcoded switch the default rule table replaces
+func legacyEthnic(ethnic1, ethnic2 Ethnic, ethnicValue int) (Ethnic, bool) {
+	hasEthnic := func(ethnic Ethnic) bool {
+		return ethnic1 == ethnic || ethnic2 == ethnic
+	}
+
+	switch ethnicValue {
+	case 0:
+		if hasEthnic(Scandinavian) {
+			return Scandinavian, true
+		}
+		if hasEthnic(Caucasian) {
+			return Caucasian, true
+		}
+		return CentralEuropean, true
+	case 1:
+		if hasEthnic(Scandinavian) || hasEthnic(SouthEastAsian) || hasEthnic(CentralEuropean) ||
+			hasEthnic(Caucasian) || hasEthnic(African) || hasEthnic(Asian) ||
+			hasEthnic(MiddleEastNorthAfrican) || hasEthnic(MiddleEastSouthAsian) ||
+			hasEthnic(EasternEuropeanCentralAsian) {
+			return SouthAmerican, true
+		}
+		if ethnic1 != "" {
+			return ethnic1, true
+		}
+		return ethnic2, true
+	case 2:
+		if hasEthnic(MiddleEastSouthAsian) {
+			return MiddleEastSouthAsian, true
+		}
+		return MiddleEastNorthAfrican, true
+	case 3, 6, 7, 8, 9:
+		if ethnicValue == 7 {
+			if ethnic1 == SouthAmericanMediterranean {
+				return SouthAmericanMediterranean, true
+			}
+			if ethnic1 == SouthAmerican {
+				return SouthAmerican, true
+			}
+		}
+		return African, true
+	case 4:
+		return MiddleEastSouthAsian, true
+	case 5:
+		return SouthEastAsian, true
+	case 10:
+		if ethnic1 == SouthAmerican {
+			return SouthAmerican, true
+		}
+		return Asian, true
+	default:
+		return "", false
+	}
+}
+
+func TestDefaultEthnicRules_MatchLegacyBehaviour(t *testing.T) {
+	seconds := append([]Ethnic{""}, Ethnicities[:]...)
+
+	for _, ethnic1 := range Ethnicities {
+		for _, ethnic2 := range seconds {
+			for ethnicValue := -1; ethnicValue <= 11; ethnicValue++ {
+				expected, known := legacyEthnic(ethnic1, ethnic2, ethnicValue)
+				actual, _, err := EvaluateEthnicRules(nil, DefaultEthnicRules, ethnic1, ethnic2, ethnicValue)
+
+				if known != (err == nil) || actual != expected {
+					t.Fatalf("%s/%s value %d: expected %q, got %q (%v)", ethnic1, ethnic2, ethnicValue, expected, actual, err)
+				}
+			}
+		}
+	}
+}
+
+func TestParseEthnicRules_RoundTrip(t *testing.T) {
+
+	data, err := MarshalEthnicRules(DefaultEthnicRules)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	rules, err := ParseEthnicRules(data, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(rules) != len(DefaultEthnicRules) {
+		t.Fatalf("expected %d rules, got %d", len(DefaultEthnicRules), len(rules))
+	}
+}
+
+func TestParseEthnicRules_InvalidEthnic(t *testing.T) {
+
+	data := []byte(`
+[[rule]]
+name = "typo"
+values = [0]
+either = ["Scandinavan"]
+result = "Scandinavian"
+`)
+
+	_, err := ParseEthnicRules(data, nil)
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+
+	expectedErrorMsg := `rule 1 "typo" references invalid ethnic "Scandinavan"`
+	if !strings.Contains(err.Error(), expectedErrorMsg) {
+		t.Fatalf("expected error message to contain %q, got %q", expectedErrorMsg, err.Error())
+	}
+}
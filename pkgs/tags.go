@@ -0,0 +1,272 @@
+package mapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// ImageTags are the traits of a face read from metadata sidecars, ex:
+// hair => dark, goalkeeper => true. Names and values are compared without
+// case
+type ImageTags map[string]string
+
+// FolderSidecars are the names of the sidecars tagging the images of a folder
+// and of its subfolders
+var FolderSidecars = []string{"tags.toml", "tags.json"}
+
+// folderSidecar is the content of a folder sidecar. Tags apply to every
+// image below the folder, images are keyed by their name without extension
+type folderSidecar struct {
+	Tags   map[string]any            `toml:"tags" json:"tags"`
+	Images map[string]map[string]any `toml:"images" json:"images"`
+}
+
+// sidecarTags converts the values of a sidecar to tags
+func sidecarTags(sidecar map[string]any) ImageTags {
+	tags := make(ImageTags, len(sidecar))
+	for name, value := range sidecar {
+		tags[strings.ToLower(name)] = fmt.Sprint(value)
+	}
+	return tags
+}
+
+// with returns the tags overlaid with others
+func (tags ImageTags) with(other ImageTags) ImageTags {
+	if len(other) == 0 {
+		return tags
+	}
+
+	merged := make(ImageTags, len(tags)+len(other))
+	maps.Copy(merged, tags)
+	maps.Copy(merged, other)
+	return merged
+}
+
+// Has reports whether the face carries a tag with the given value
+func (tags ImageTags) Has(name string, value string) bool {
+	tagValue, found := tags[strings.ToLower(name)]
+	return found && strings.EqualFold(tagValue, value)
+}
+
+func (tags ImageTags) String() string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%s", name, tags[name])
+	}
+	return strings.Join(pairs, " ")
+}
+
+// isSidecar reports whether a file holds tags rather than a face
+func isSidecar(filename string) bool {
+	extension := strings.ToLower(path.Ext(filename))
+	return extension == ".toml" || extension == ".json"
+}
+
+// isFolderSidecar reports whether a file tags the images of its folder
+func isFolderSidecar(filename string) bool {
+	return slices.ContainsFunc(FolderSidecars, func(name string) bool { return strings.EqualFold(name, filename) })
+}
+
+// decodeSidecar reads a TOML or JSON sidecar into value
+func decodeSidecar(sidecarPath string, value any) error {
+	data, err := os.ReadFile(sidecarPath)
+	if err != nil {
+		return err
+	}
+
+	if strings.ToLower(filepath.Ext(sidecarPath)) == ".json" {
+		return json.Unmarshal(data, value)
+	}
+	return toml.Unmarshal(data, value)
+}
+
+// folderTags reads the sidecars of a folder. It returns the tags of the
+// folder on top of the inherited ones, the tags of its images by name
+// without extension, and the sidecar files so that they are not reported
+// as ignored. Sidecars that cannot be read are reported as invalid
+func (reader *poolReader) folderTags(dir string, folder IndexFolder, inherited ImageTags) (ImageTags, map[string]ImageTags, map[string]bool) {
+	images := make(map[string]bool)
+	for _, entry := range folder.Entries {
+		if !entry.Folder && IsImageFile(entry.Name) {
+			images[strings.TrimSuffix(entry.Name, path.Ext(entry.Name))] = true
+		}
+	}
+
+	folderTags := ImageTags{}
+	ownTags := make(map[string]ImageTags)
+	sidecars := make(map[string]bool)
+	for _, entry := range folder.Entries {
+		image := strings.TrimSuffix(entry.Name, path.Ext(entry.Name))
+		if entry.Folder || !isSidecar(entry.Name) || !(isFolderSidecar(entry.Name) || images[image]) {
+			continue
+		}
+		sidecars[entry.Name] = true
+		sidecarPath := filepath.Join(reader.root, filepath.FromSlash(path.Join(dir, entry.Name)))
+
+		var err error
+		if isFolderSidecar(entry.Name) {
+			var sidecar folderSidecar
+			if err = decodeSidecar(sidecarPath, &sidecar); err == nil {
+				folderTags = folderTags.with(sidecarTags(sidecar.Tags))
+				for image, imageSidecar := range sidecar.Images {
+					// per image sidecars, such as face.toml next to face.png, win
+					ownTags[image] = sidecarTags(imageSidecar).with(ownTags[image])
+				}
+			}
+		} else {
+			var sidecar map[string]any
+			if err = decodeSidecar(sidecarPath, &sidecar); err == nil {
+				ownTags[image] = ownTags[image].with(sidecarTags(sidecar))
+			}
+		}
+
+		if err != nil {
+			reader.report.Invalid = append(reader.report.Invalid, PoolIssue{File: path.Join(dir, entry.Name), Reason: fmt.Sprintf("cannot read tags: %v", err)})
+		}
+	}
+
+	tags := inherited.with(folderTags)
+	imageTags := make(map[string]ImageTags, len(ownTags))
+	for image, own := range ownTags {
+		imageTags[image] = tags.with(own)
+	}
+	return tags, imageTags, sidecars
+}
+
+// PlayerFields lists the player fields tag rules can match
+var PlayerFields = []string{"nationality", "second_nationality", "ethnic", "ethnic_value", "skin_tone", "age"}
+
+// playerField returns a field of the player as text and whether it is
+// numeric
+func playerField(player Player, field string) (string, bool) {
+	switch field {
+	case "nationality":
+		return player.Nationality, false
+	case "second_nationality":
+		return player.SecondNationality, false
+	case "ethnic":
+		return string(player.Ethnic), false
+	case "ethnic_value":
+		return strconv.Itoa(player.EthnicValue), true
+	case "skin_tone":
+		return strconv.Itoa(player.SkinTone), true
+	case "age":
+		return strconv.Itoa(player.Age), true
+	}
+	return "", false
+}
+
+var rangeRegex = regexp.MustCompile(`^(\d+)(?:-(\d+))?$`)
+
+// matchesField reports whether a player field has a value, or lies in a
+// range such as 1-5 for numeric fields
+func matchesField(player Player, field string, value string) bool {
+	fieldValue, numeric := playerField(player, field)
+	if !numeric {
+		return strings.EqualFold(fieldValue, value)
+	}
+
+	valueRange, isRange := parseBucket(rangeRegex, value)
+	number, err := strconv.Atoi(fieldValue)
+	return isRange && err == nil && valueRange.Contains(number)
+}
+
+// TagRule steers the players it matches to faces carrying its tags. Rules
+// are applied in order, each narrowing the faces the previous ones left
+type TagRule struct {
+	Name     string            `toml:"name,omitempty"`
+	When     map[string]string `toml:"when,omitempty"`     // player fields and the value or range they must have, ex: skin_tone = "1-5", empty for every player
+	Tags     map[string]string `toml:"tags"`               // tags the face must have, ex: hair = "dark"
+	Required bool              `toml:"required,omitempty"` // leave the group's faces out when none has the tags, otherwise the rule is skipped
+}
+
+func (rule TagRule) String() string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return ImageTags(rule.Tags).String()
+}
+
+// matches reports whether the rule applies to the player
+func (rule TagRule) matches(player Player) bool {
+	for field, value := range rule.When {
+		if !matchesField(player, field, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetTagRules validates and sets the tag rules of the pool
+func (images *ImagePool) SetTagRules(rules []TagRule) error {
+	ruleErrors := []error{}
+	for i, rule := range rules {
+		if len(rule.Tags) == 0 {
+			ruleErrors = append(ruleErrors, fmt.Errorf("tag rule %d: no tags given", i+1))
+		}
+		for field := range rule.When {
+			if !slices.Contains(PlayerFields, field) {
+				ruleErrors = append(ruleErrors, fmt.Errorf(`tag rule %d: "%s" is not a player field, use one of %s`, i+1, field, strings.Join(PlayerFields, ", ")))
+			}
+		}
+	}
+	if len(ruleErrors) > 0 {
+		return errors.Join(ruleErrors...)
+	}
+
+	images.tagRules = rules
+	return nil
+}
+
+// matchingTags narrows the candidates by the tag rules matching the player.
+// False is returned when a required rule leaves no candidate
+func (images *ImagePool) matchingTags(ethnicPool []PoolImage, candidates []int, player Player) ([]int, bool) {
+	for _, rule := range images.tagRules {
+		if !rule.matches(player) {
+			continue
+		}
+
+		tagged := make([]int, 0, len(candidates))
+		for _, index := range candidates {
+			if hasTags(ethnicPool[index].Tags, rule.Tags) {
+				tagged = append(tagged, index)
+			}
+		}
+
+		switch {
+		case len(tagged) > 0:
+			candidates = tagged
+		case rule.Required:
+			return nil, false
+		}
+	}
+	return candidates, true
+}
+
+// hasTags reports whether a face carries every tag of a rule
+func hasTags(tags ImageTags, ruleTags map[string]string) bool {
+	for name, value := range ruleTags {
+		if !tags.Has(name, value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package mapper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSidecar writes a metadata sidecar relative to the image root
+func writeSidecar(t *testing.T, root, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(file)), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write sidecar: %v", err)
+	}
+}
+
+func setupTaggedRoot(t *testing.T) string {
+	t.Helper()
+	root := setupImageRoot(t, "African/a.png", "African/b.png", "African/part1/c.png")
+	writeSidecar(t, root, "African/tags.toml", `
+[tags]
+hair = "dark"
+
+[images.a]
+goalkeeper = true
+`)
+	writeSidecar(t, root, "African/b.json", `{"hair": "Blond"}`)
+	return root
+}
+
+func TestNewImagePool_Tags(t *testing.T) {
+	root := setupTaggedRoot(t)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	report := pool.Report()
+	if len(report.Ignored) != 0 || !report.Valid() {
+		t.Fatalf("expected the sidecars to be read, got %v", report)
+	}
+
+	tags := make(map[string]string)
+	for _, info := range report.Images {
+		tags[info.File] = info.Tags.String()
+	}
+	expected := map[string]string{
+		"African/a.png":       "goalkeeper=true hair=dark",
+		"African/b.png":       "hair=Blond",
+		"African/part1/c.png": "hair=dark",
+	}
+	for file, expectedTags := range expected {
+		if tags[file] != expectedTags {
+			t.Fatalf("expected %s to be tagged %q, got %q", file, expectedTags, tags[file])
+		}
+	}
+}
+
+func TestNewImagePool_InvalidSidecar(t *testing.T) {
+	root := setupImageRoot(t, "African/a.png")
+	writeSidecar(t, root, "African/a.toml", "hair = ")
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	report := pool.Report()
+	if len(report.Invalid) != 1 || report.Invalid[0].File != "African/a.toml" || len(report.Images) != 1 {
+		t.Fatalf("expected the sidecar to be reported as invalid, got %+v", report)
+	}
+}
+
+func TestGetImagePath_TagRules(t *testing.T) {
+	root := setupTaggedRoot(t)
+
+	pool, err := NewImagePool(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	err = pool.SetTagRules([]TagRule{
+		{When: map[string]string{"skin_tone": "10-20"}, Tags: map[string]string{"goalkeeper": "true"}},
+		{When: map[string]string{"nationality": "fra"}, Tags: map[string]string{"hair": "blond"}},
+		{When: map[string]string{"nationality": "GER"}, Tags: map[string]string{"hair": "red"}, Required: true},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		image, _, err := pool.GetImagePath(Player{Ethnic: African, SkinTone: 15}, false)
+		if err != nil || image != "African/a" {
+			t.Fatalf("expected the goalkeeper image, got %s %v", image, err)
+		}
+
+		image, _, err = pool.GetImagePath(Player{Ethnic: African, Nationality: "FRA"}, false)
+		if err != nil || image != "African/b" {
+			t.Fatalf("expected the blond image, got %s %v", image, err)
+		}
+	}
+
+	// a soft rule without a matching face is skipped, a required one is not
+	if _, _, err := pool.GetImagePath(Player{Ethnic: African, Nationality: "FRA", SkinTone: 2}, false); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, _, err := pool.GetImagePath(Player{Ethnic: African, Nationality: "GER"}, false); err == nil {
+		t.Fatalf("expected an error for the required rule")
+	}
+}
+
+func TestSetTagRules_Invalid(t *testing.T) {
+	pool, err := NewImagePool(setupImageRoot(t))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	err = pool.SetTagRules([]TagRule{
+		{When: map[string]string{"height": "180"}, Tags: map[string]string{"hair": "dark"}},
+		{When: map[string]string{"skin_tone": "1-5"}},
+	})
+	if err == nil {
+		t.Fatalf("expected an error for an unknown field and a rule without tags")
+	}
+}
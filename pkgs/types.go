@@ -2,16 +2,25 @@ package mapper
 
 type FilePath string
 
+// Ethnic is the name of a built-in or user-defined ethnic group
 type Ethnic string
 
+// IsValidEthnic reports whether ethnic is a built-in group, see
+// EthnicGroups.IsValid for the groups of a run
 func IsValidEthnic(ethnic string) bool {
-	validEthnic := EthnicSet.Contains(Ethnic(ethnic))
-	return validEthnic
+	return (*EthnicGroups)(nil).IsValid(ethnic)
 }
 
 type PlayerID string
 
 type Player struct {
-	ID     PlayerID
-	Ethnic Ethnic
+	ID                PlayerID
+	Ethnic            Ethnic
+	Nationality       string
+	SecondNationality string
+	EthnicValue       int
+	SkinTone          int    // 0 when unknown
+	Age               int    // 0 when unknown or not exported
+	Source            string // RTF file the player was read from
+	Warning           string // set when the ethnic was resolved by the unknown nationality policy
 }
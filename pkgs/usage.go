@@ -0,0 +1,74 @@
+package mapper
+
+import "sort"
+
+// ImageUsage lists the players an image is given to
+type ImageUsage struct {
+	Image   FilePath   // path written to the mapping
+	Players []PlayerID // sorted, empty for pool images nobody uses
+}
+
+// EthnicUsage is the usage of the images of an ethnic folder
+type EthnicUsage struct {
+	Ethnic Ethnic // empty for images outside of the ethnic folders
+	Images []ImageUsage
+}
+
+// Uses returns the number of players given an image of the ethnic
+func (usage EthnicUsage) Uses() int {
+	uses := 0
+	for _, image := range usage.Images {
+		uses += len(image.Players)
+	}
+	return uses
+}
+
+// UsageReport groups the images of the mapping by ethnic folder with the
+// players using them, most used first. Unused images of the pool are listed
+// too when a pool is given
+func UsageReport(mapping *Mapping, images *ImagePool, options AssignOptions) []EthnicUsage {
+	players := make(map[FilePath][]PlayerID)
+	for id, image := range mapping.idImageMap {
+		players[image] = append(players[image], id)
+	}
+
+	if images != nil {
+		for _, ethnicPool := range images.pool {
+			for _, image := range ethnicPool {
+				mapped := options.mappedPath(image.Path)
+				if _, used := players[mapped]; !used {
+					players[mapped] = nil
+				}
+			}
+		}
+	}
+
+	byEthnic := make(map[Ethnic][]ImageUsage)
+	for image, ids := range players {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		var ethnic Ethnic
+		if poolImage, inPool := options.poolPath(image); inPool {
+			ethnic, _ = options.Groups.ImageEthnic(options.rootImage(poolImage))
+		}
+		byEthnic[ethnic] = append(byEthnic[ethnic], ImageUsage{Image: image, Players: ids})
+	}
+
+	report := make([]EthnicUsage, 0, len(byEthnic))
+	for _, ethnic := range append(options.Groups.All(), "") {
+		usages, found := byEthnic[ethnic]
+		if !found {
+			continue
+		}
+
+		sort.Slice(usages, func(i, j int) bool {
+			if len(usages[i].Players) != len(usages[j].Players) {
+				return len(usages[i].Players) > len(usages[j].Players)
+			}
+			return usages[i].Image < usages[j].Image
+		})
+		report = append(report, EthnicUsage{Ethnic: ethnic, Images: usages})
+	}
+
+	return report
+}
@@ -13,14 +13,46 @@ func MapValues[M ~map[K]V, K comparable, V any](m M) []V {
 	return r
 }
 
-func OverrideNationEthnicMapping(overrides map[string]string) error {
+// OverrideNationEthnicMapping applies the mapping overrides of the config to
+// the resolver. Keys are a nation ("FRA") or a first nationality and ethnic value pair
+// ("FRA:0"), values are a single ethnic or a weighted distribution such as
+// {"Central European": 0.7, "Italmed": 0.3}
+func OverrideNationEthnicMapping[V any](resolver *Resolver, overrides map[string]V) error {
 	overrideErrors := []error{}
 
-	for nation, ethnic := range overrides {
-		if !IsValidEthnic(ethnic) {
-			overrideErrors = append(overrideErrors, fmt.Errorf(`ethnic value "%s" is not valid ethnic for "%s"`, ethnic, nation))
-		} else {
-			NationEthnicMapping[nation] = Ethnic(ethnic)
+	for key, override := range overrides {
+		nation, isPair, err := splitOverrideKey(key)
+		if err != nil {
+			overrideErrors = append(overrideErrors, err)
+			continue
+		}
+		nation = resolver.canonical(nation)
+
+		if ethnic, isSingle := any(override).(string); isSingle && !resolver.groups.IsValid(ethnic) {
+			overrideErrors = append(overrideErrors, fmt.Errorf(`ethnic value "%s" is not valid ethnic for "%s"`, ethnic, key))
+			continue
+		}
+
+		weights, err := ToEthnicWeights(override)
+		if err == nil {
+			err = validateEthnicWeights(resolver.groups, weights)
+		}
+		if err != nil {
+			overrideErrors = append(overrideErrors, fmt.Errorf(`invalid weights for "%s": %w`, key, err))
+			continue
+		}
+
+		switch {
+		case isPair:
+			resolver.weights[resolver.canonicalKey(key)] = weights
+		case len(weights) == 1:
+			resolver.nations[nation] = weights.Dominant()
+			resolver.overridden[nation] = true
+			delete(resolver.weights, nation)
+		default:
+			resolver.nations[nation] = weights.Dominant()
+			resolver.overridden[nation] = true
+			resolver.weights[nation] = weights
 		}
 	}
 
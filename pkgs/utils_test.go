@@ -2,46 +2,47 @@ package mapper
 
 import (
 	"testing"
-
-	mapset "github.com/deckarep/golang-set/v2"
 )
 
-func setup() {
-	NationEthnicMapping = make(map[string]Ethnic)
+func setup() *Resolver {
+	resolver := &Resolver{
+		nations: make(map[string]Ethnic),
+		weights: make(map[string]EthnicWeights),
+		rules:   DefaultEthnicRules,
+
+		overridden: make(map[string]bool),
+	}
 
-	EthnicSet = mapset.NewSet[Ethnic]()
-	EthnicSet.Add(African)
-	EthnicSet.Add(Asian)
-	EthnicSet.Add(Caucasian)
+	return resolver
 }
 
 func TestOverrideNationEthnicMapping_ValidOverrides(t *testing.T) {
-	setup()
+	resolver := setup()
 
 	overrides := map[string]string{
 		"USA": "African",
 		"IND": "Caucasian",
 	}
 
-	err := OverrideNationEthnicMapping(overrides)
+	err := OverrideNationEthnicMapping(resolver, overrides)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	if NationEthnicMapping["USA"] != African || NationEthnicMapping["IND"] != Caucasian {
+	if resolver.nations["USA"] != African || resolver.nations["IND"] != Caucasian {
 		t.Fatal("expected mappings to be updated, but they were not")
 	}
 }
 
 func TestOverrideNationEthnicMapping_InvalidOverrides(t *testing.T) {
-	setup()
+	resolver := setup()
 
 	overrides := map[string]string{
 		"USA": "Caucasian",
 		"IND": "FakeEthnic", // Invalid ethnic input
 	}
 
-	err := OverrideNationEthnicMapping(overrides)
+	err := OverrideNationEthnicMapping(resolver, overrides)
 	if err == nil {
 		t.Fatal("expected an error but got none")
 	}
@@ -53,7 +54,7 @@ func TestOverrideNationEthnicMapping_InvalidOverrides(t *testing.T) {
 }
 
 func TestOverrideNationEthnicMapping_MixedValidAndInvalid(t *testing.T) {
-	setup()
+	resolver := setup()
 
 	overrides := map[string]string{
 		"USA": "Caucasian",
@@ -61,13 +62,13 @@ func TestOverrideNationEthnicMapping_MixedValidAndInvalid(t *testing.T) {
 		"GBR": "Asian",
 	}
 
-	err := OverrideNationEthnicMapping(overrides)
+	err := OverrideNationEthnicMapping(resolver, overrides)
 	if err == nil {
 		t.Fatal("expected an error but got none")
 	}
 
 	// Valid entries should still be added
-	if NationEthnicMapping["USA"] != Caucasian || NationEthnicMapping["GBR"] != Asian {
+	if resolver.nations["USA"] != Caucasian || resolver.nations["GBR"] != Asian {
 		t.Fatal("valid mappings should have been updated, but they were not")
 	}
 
@@ -79,12 +80,122 @@ func TestOverrideNationEthnicMapping_MixedValidAndInvalid(t *testing.T) {
 }
 
 func TestOverrideNationEthnicMapping_NoOverrides(t *testing.T) {
-	setup()
+	resolver := setup()
 
 	overrides := map[string]string{} // empty map
 
-	err := OverrideNationEthnicMapping(overrides)
+	err := OverrideNationEthnicMapping(resolver, overrides)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestOverrideNationEthnicMapping_WeightedOverrides(t *testing.T) {
+	resolver := setup()
+
+	overrides := map[string]any{
+		"USA":   map[string]any{"Caucasian": 0.7, "African": int64(3)},
+		"IND:4": "Asian",
+	}
+
+	err := OverrideNationEthnicMapping(resolver, overrides)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// the dominant ethnic is used as the nation's mapping
+	if resolver.nations["USA"] != African {
+		t.Fatalf("expected USA to map to African, got %q", resolver.nations["USA"])
+	}
+	if resolver.weights["USA"][Caucasian] != 0.7 {
+		t.Fatal("expected USA weights to be stored, but they were not")
+	}
+
+	// pair overrides do not touch the nation's mapping
+	if _, ok := resolver.nations["IND"]; ok {
+		t.Fatal("expected IND to stay unmapped")
+	}
+	if resolver.weights["IND:4"][Asian] != 1 {
+		t.Fatal("expected IND:4 override to be stored, but it was not")
+	}
+}
+
+func TestOverrideNationEthnicMapping_InvalidWeights(t *testing.T) {
+	resolver := setup()
+
+	overrides := map[string]any{
+		"USA": map[string]any{"Caucasian": 0.5, "FakeEthnic": 0.5},
+	}
+
+	err := OverrideNationEthnicMapping(resolver, overrides)
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+
+	expectedErrorMsg := `invalid weights for "USA": ethnic value "FakeEthnic" is not valid ethnic`
+	if err.Error() != expectedErrorMsg {
+		t.Fatalf("expected error message to be %q, got %q", expectedErrorMsg, err.Error())
+	}
+	if _, ok := resolver.weights["USA"]; ok {
+		t.Fatal("invalid weights should not have been stored")
+	}
+}
+
+func TestGetEthnic_WeightedNation(t *testing.T) {
+	resolver := setup()
+	resolver.nations["ITA"] = ItalianMediterranean
+	resolver.weights["ITA"] = EthnicWeights{ItalianMediterranean: 0, SpanishMediterranean: 1}
+
+	// "mediterranean" takes the nation's dominant ethnic, so it is resampled
+	ethnic, err := getEthnic(resolver, "ITA", "", 1)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
+	if ethnic != SpanishMediterranean {
+		t.Fatalf("expected SpanMed, got %q", ethnic)
+	}
+
+	// other results are kept
+	ethnic, err = getEthnic(resolver, "ITA", "", 3)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ethnic != African {
+		t.Fatalf("expected African, got %q", ethnic)
+	}
+}
+
+func TestGetEthnic_WeightedNationValueRule(t *testing.T) {
+	resolver := setup()
+	resolver.nations["RSA"] = African
+	resolver.weights["RSA"] = EthnicWeights{African: 0.6, CentralEuropean: 0.4}
+
+	// "black and mixed" gives African from the ethnic value alone, the
+	// nation's distribution is not drawn from
+	for i := 0; i < 50; i++ {
+		ethnic, trace, err := traceEthnic(resolver, "RSA", "", 3)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if ethnic != African || trace.OverrideKey != "" {
+			t.Fatalf("expected African without a draw, got %q %q", ethnic, trace.OverrideKey)
+		}
+	}
+}
+
+func TestNewResolver_OverridesDoNotLeak(t *testing.T) {
+	setup()
+
+	first := NewResolver()
+	if err := OverrideNationEthnicMapping(first, map[string]string{"FRA": string(Asian)}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	second := NewResolver()
+	if ethnic, _ := second.Nation("FRA"); ethnic != CentralEuropean {
+		t.Fatalf("expected FRA to map to Central European in a new resolver, got %q", ethnic)
+	}
+	if NationEthnicMapping["FRA"] != CentralEuropean {
+		t.Fatalf("expected the built-in table to be untouched, got %q", NationEthnicMapping["FRA"])
+	}
 }
@@ -0,0 +1,173 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EthnicWeights is a weighted distribution of ethnics, ex: FRA =>
+// {"Central European": 0.7, "Italmed": 0.3}. Weights do not have to sum to 1
+type EthnicWeights map[Ethnic]float64
+
+// sortedEthnics returns the ethnics of the distribution in a stable order
+func (weights EthnicWeights) sortedEthnics() []Ethnic {
+	ethnics := make([]Ethnic, 0, len(weights))
+	for ethnic := range weights {
+		ethnics = append(ethnics, ethnic)
+	}
+	sort.Slice(ethnics, func(i, j int) bool { return ethnics[i] < ethnics[j] })
+	return ethnics
+}
+
+// Dominant returns the ethnic with the highest weight
+func (weights EthnicWeights) Dominant() Ethnic {
+	var dominant Ethnic
+	for _, ethnic := range weights.sortedEthnics() {
+		if dominant == "" || weights[ethnic] > weights[dominant] {
+			dominant = ethnic
+		}
+	}
+	return dominant
+}
+
+// Sample draws an ethnic from the distribution
+func (weights EthnicWeights) Sample() Ethnic {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+
+	target := rand.Float64() * total
+	ethnics := weights.sortedEthnics()
+	for _, ethnic := range ethnics {
+		target -= weights[ethnic]
+		if target < 0 {
+			return ethnic
+		}
+	}
+	return ethnics[len(ethnics)-1]
+}
+
+// String formats the distribution as read by ParseEthnicWeights
+func (weights EthnicWeights) String() string {
+	parts := make([]string, 0, len(weights))
+	for _, ethnic := range weights.sortedEthnics() {
+		parts = append(parts, fmt.Sprintf("%s=%s", ethnic, strconv.FormatFloat(weights[ethnic], 'f', -1, 64)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ParseEthnicWeights reads a distribution such as "Central European=0.7, Italmed=0.3"
+// of the given ethnic groups
+func ParseEthnicWeights(text string, groups *EthnicGroups) (EthnicWeights, error) {
+	weights := make(EthnicWeights)
+
+	for _, part := range strings.Split(text, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		ethnic, weightText, found := strings.Cut(part, "=")
+		if !found {
+			return nil, fmt.Errorf(`weight "%s" is not in the form ethnic=weight`, strings.TrimSpace(part))
+		}
+
+		weight, err := strconv.ParseFloat(strings.TrimSpace(weightText), 64)
+		if err != nil {
+			return nil, fmt.Errorf(`weight "%s" is not a number`, strings.TrimSpace(weightText))
+		}
+
+		weights[Ethnic(strings.TrimSpace(ethnic))] = weight
+	}
+
+	if err := validateEthnicWeights(groups, weights); err != nil {
+		return nil, err
+	}
+
+	return weights, nil
+}
+
+// ToEthnicWeights converts a mapping override value, a single ethnic or a
+// table of weights as decoded from TOML or JSON, into a distribution
+func ToEthnicWeights(value any) (EthnicWeights, error) {
+	switch typed := value.(type) {
+	case string:
+		return EthnicWeights{Ethnic(typed): 1}, nil
+	case Ethnic:
+		return EthnicWeights{typed: 1}, nil
+	case EthnicWeights:
+		return typed, nil
+	case map[string]float64:
+		weights := make(EthnicWeights)
+		for ethnic, weight := range typed {
+			weights[Ethnic(ethnic)] = weight
+		}
+		return weights, nil
+	case map[string]any:
+		weights := make(EthnicWeights)
+		for ethnic, rawWeight := range typed {
+			switch weight := rawWeight.(type) {
+			case float64:
+				weights[Ethnic(ethnic)] = weight
+			case int64:
+				weights[Ethnic(ethnic)] = float64(weight)
+			case int:
+				weights[Ethnic(ethnic)] = float64(weight)
+			default:
+				return nil, fmt.Errorf(`weight of "%s" is not a number`, ethnic)
+			}
+		}
+		return weights, nil
+	default:
+		return nil, fmt.Errorf("unsupported override value %v", value)
+	}
+}
+
+func validateEthnicWeights(groups *EthnicGroups, weights EthnicWeights) error {
+	if len(weights) == 0 {
+		return errors.New("no ethnic weights given")
+	}
+
+	weightErrors := []error{}
+	total := 0.0
+	for _, ethnic := range weights.sortedEthnics() {
+		weight := weights[ethnic]
+		if !groups.IsValid(string(ethnic)) {
+			weightErrors = append(weightErrors, fmt.Errorf(`ethnic value "%s" is not valid ethnic`, ethnic))
+		}
+		if weight < 0 {
+			weightErrors = append(weightErrors, fmt.Errorf(`weight of "%s" is negative`, ethnic))
+		}
+		total += weight
+	}
+
+	if len(weightErrors) == 0 && total <= 0 {
+		weightErrors = append(weightErrors, errors.New("weights add up to 0"))
+	}
+
+	return errors.Join(weightErrors...)
+}
+
+// splitOverrideKey returns the nation of an override key and whether the key
+// is a nation and ethnic value pair such as "FRA:0"
+func splitOverrideKey(key string) (string, bool, error) {
+	nation, value, isPair := strings.Cut(key, ":")
+	if !isPair {
+		return key, false, nil
+	}
+
+	if _, err := strconv.Atoi(value); err != nil {
+		return "", false, fmt.Errorf(`override "%s" has an invalid ethnic value`, key)
+	}
+
+	return nation, true, nil
+}
+
+// pairKey returns the override key for a nation and ethnic value
+func pairKey(nation string, ethnicValue int) string {
+	return fmt.Sprintf("%s:%d", nation, ethnicValue)
+}